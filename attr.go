@@ -118,6 +118,7 @@ var attrTypeMap = map[string]contentType{
 	"sizes":       contentTypePlain,
 	"span":        contentTypePlain,
 	"src":         contentTypeURL,
+	"srcset":      contentTypeSrcset,
 	"srcdoc":      contentTypeHTML,
 	"srclang":     contentTypePlain,
 	"start":       contentTypePlain,
@@ -132,12 +133,21 @@ var attrTypeMap = map[string]contentType{
 	"width":       contentTypePlain,
 	"wrap":        contentTypePlain,
 	"xmlns":       contentTypeURL,
+	// Popover attributes. The target holds an element ID, like for.
+	"popover":             contentTypePlain,
+	"popovertarget":       contentTypePlain,
+	"popovertargetaction": contentTypePlain,
 }
 
 // attrType returns a conservative (upper-bound on authority) guess at the
 // type of the named attribute.
 func attrType(name string) contentType {
 	name = strings.ToLower(name)
+	if strings.HasPrefix(name, "aria-") {
+		// ARIA attributes hold text labels, ID references, and tokens,
+		// so the custom attribute heuristics below do not apply.
+		return contentTypePlain
+	}
 	if strings.HasPrefix(name, "data-") {
 		// Strip data- so that custom attribute heuristics below are
 		// widely applied.
@@ -173,3 +183,38 @@ func attrType(name string) contentType {
 	}
 	return contentTypePlain
 }
+
+// langAttrs is the set of attributes whose values are BCP 47 language tags.
+// They are plain text as far as escaping is concerned, but Escaper.Warn is
+// told about values that are not well-formed language tags.
+var langAttrs = map[string]bool{
+	"hreflang": true,
+	"lang":     true,
+	"srclang":  true,
+	"xml:lang": true,
+}
+
+// isLangAttr reports whether the named attribute holds a language tag.
+func isLangAttr(name string) bool {
+	return langAttrs[strings.ToLower(name)]
+}
+
+// isLangTag reports whether s looks like a BCP 47 language tag: subtags of
+// one to eight ASCII letters and digits, separated by hyphens. The empty
+// string is allowed too; it means the language is unknown.
+func isLangTag(s string) bool {
+	if s == "" {
+		return true
+	}
+	for _, sub := range strings.Split(s, "-") {
+		if len(sub) == 0 || len(sub) > 8 {
+			return false
+		}
+		for i := 0; i < len(sub); i++ {
+			if !asciiAlphaNum(sub[i]) {
+				return false
+			}
+		}
+	}
+	return true
+}
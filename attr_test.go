@@ -0,0 +1,152 @@
+package escaper
+
+import (
+	"html"
+	"strings"
+	"testing"
+)
+
+func TestAttrType(t *testing.T) {
+	tests := []struct {
+		name string
+		want contentType
+	}{
+		{"aria-label", contentTypePlain},
+		{"aria-describedby", contentTypePlain},
+		{"ARIA-Label", contentTypePlain},
+		{"aria-src", contentTypePlain},
+		{"aria-onclick", contentTypePlain},
+		{"data-src", contentTypeURL},
+		{"data-onclick", contentTypeJS},
+		{"onclick", contentTypeJS},
+		{"href", contentTypeURL},
+		{"xlink:href", contentTypeURL},
+		{"title", contentTypePlain},
+		{"open", contentTypePlain},
+		{"popover", contentTypePlain},
+		{"popovertarget", contentTypePlain},
+		{"popoverTargetAction", contentTypePlain},
+	}
+	for _, tt := range tests {
+		if got := attrType(tt.name); got != tt.want {
+			t.Errorf("attrType(%q) = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestARIAAttrs(t *testing.T) {
+	runValueTests(t, nil, []valueTest{
+		{"label", `<button aria-label="`, `">`, `Say "hi" > bye`, `<button aria-label="Say &#34;hi&#34; &gt; bye">`},
+		{"unquoted", `<button aria-label=`, `>`, `a'b<c`, `<button aria-label="a&#39;b&lt;c">`},
+		{"URL-like", `<div aria-src="`, `">`, "javascript:alert(1)", `<div aria-src="javascript:alert(1)">`},
+		{"handler-like", `<div aria-onclick="`, `">`, "alert(1)", `<div aria-onclick="alert(1)">`},
+	})
+}
+
+func TestIsLangTag(t *testing.T) {
+	tests := []struct {
+		s    string
+		want bool
+	}{
+		{"", true},
+		{"en", true},
+		{"en-US", true},
+		{"zh-Hant-TW", true},
+		{"x-klingon", true},
+		{"de-CH-1996", true},
+		{"en_US", false},
+		{"en-", false},
+		{"-en", false},
+		{"en--US", false},
+		{"abcdefghi", false},
+		{"en US", false},
+		{`en-US"><script>`, false},
+	}
+	for _, tt := range tests {
+		if got := isLangTag(tt.s); got != tt.want {
+			t.Errorf("isLangTag(%q) = %v, want %v", tt.s, got, tt.want)
+		}
+	}
+}
+
+func TestLangAttrs(t *testing.T) {
+	tests := []struct {
+		before, after string
+		value         string
+		want          string
+		warn          bool
+	}{
+		{`<html lang="`, `">`, "en-US", `<html lang="en-US">`, false},
+		{`<html lang="`, `">`, `en-US"><script>`, `<html lang="en-US&#34;&gt;&lt;script&gt;">`, true},
+		{`<track srclang=`, `>`, "fr", `<track srclang="fr">`, false},
+		{`<track srclang=`, `>`, "fr ca", `<track srclang="fr ca">`, true},
+		{`<a hreflang="`, `">`, "de", `<a hreflang="de">`, false},
+		{`<a hreflang="`, `">`, "de/", `<a hreflang="de/">`, true},
+		{`<p xml:lang="`, `">`, "<", `<p xml:lang="&lt;">`, true},
+		{`<p title="`, `">`, "<", `<p title="&lt;">`, false},
+	}
+	for _, tt := range tests {
+		var b strings.Builder
+		e := New(&b)
+		warned := false
+		e.Warn = func(err error) { warned = true }
+		e.Literal(tt.before)
+		if err := e.Value(tt.value); err != nil {
+			t.Errorf("%s%s: %v", tt.before, tt.value, err)
+			continue
+		}
+		e.Literal(tt.after)
+		if got := b.String(); got != tt.want {
+			t.Errorf("got %q, want %q", got, tt.want)
+		}
+		if warned != tt.warn {
+			t.Errorf("%s%s: warned = %v, want %v", tt.before, tt.value, warned, tt.warn)
+		}
+	}
+}
+
+func TestPopoverAttrs(t *testing.T) {
+	runValueTests(t, nil, []valueTest{
+		{"popovertarget", `<button popovertarget="`, `">`, `menu" onclick="alert(1)`, `<button popovertarget="menu&#34; onclick=&#34;alert(1)">`},
+		{"popovertarget unquoted", `<button popovertarget=`, `>`, "my menu", `<button popovertarget="my menu">`},
+		{"popovertargetaction", `<button popovertargetaction="`, `">`, "toggle", `<button popovertargetaction="toggle">`},
+		{"popover", `<div popover="`, `">`, "manual", `<div popover="manual">`},
+		{"javascript", `<button popovertarget="`, `">`, "javascript:alert(1)", `<button popovertarget="javascript:alert(1)">`},
+	})
+
+	got, err := render(nil, "<dialog open>", "<b>", "</dialog>")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "<dialog open>&lt;b&gt;</dialog>"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestIntegrityAttr(t *testing.T) {
+	// '+' is escaped, but the HTML parser decodes it back, so the attribute
+	// value is the original hash.
+	tests := []struct {
+		value, want string
+	}{
+		{
+			"sha384-oqVuAfXRKap7fdgcCY5uykM6+R9GqQ8K/uxy9rx7HNQlGYl1kPzQho1wx4JwY8wC",
+			"sha384-oqVuAfXRKap7fdgcCY5uykM6&#43;R9GqQ8K/uxy9rx7HNQlGYl1kPzQho1wx4JwY8wC",
+		},
+		{"sha256-abc+/de==", "sha256-abc&#43;/de=="},
+		{"sha256-a/b= sha512-c+d==", "sha256-a/b= sha512-c&#43;d=="},
+		{`sha256-a" onload="x`, "sha256-a&#34; onload=&#34;x"},
+	}
+	var vts []valueTest
+	for _, tt := range tests {
+		if got := html.UnescapeString(tt.want); got != tt.value {
+			t.Errorf("%q decodes to %q", tt.want, got)
+		}
+		want := `<script src="/a.js" integrity="` + tt.want + `"></script>`
+		vts = append(vts,
+			valueTest{"quoted", `<script src="/a.js" integrity="`, `"></script>`, tt.value, want},
+			valueTest{"auto-quoted", `<script src="/a.js" integrity=`, `></script>`, tt.value, want},
+		)
+	}
+	runValueTests(t, nil, vts)
+}
@@ -0,0 +1,28 @@
+package escaper
+
+import "unsafe"
+
+// LiteralBytes is like Literal, but it takes a byte slice. The bytes are
+// parsed and written without being copied to a string first. b is not
+// retained after LiteralBytes returns.
+func (e *Escaper) LiteralBytes(b []byte) error {
+	e.borrowed = true
+	defer func() { e.borrowed = false }()
+	return e.Literal(bytesToString(b))
+}
+
+// ValueBytes is like Value, but it takes a byte slice, which is escaped as a
+// string. (Value would format a []byte as a list of numbers.) b is not
+// retained after ValueBytes returns.
+func (e *Escaper) ValueBytes(b []byte) error {
+	e.borrowed = true
+	defer func() { e.borrowed = false }()
+	return e.Value(bytesToString(b))
+}
+
+// bytesToString returns a string that shares its memory with b. The string
+// must not be used after b is modified, so anything that is kept after
+// LiteralBytes or ValueBytes returns must be copied (see e.borrowed).
+func bytesToString(b []byte) string {
+	return *(*string)(unsafe.Pointer(&b))
+}
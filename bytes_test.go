@@ -0,0 +1,79 @@
+package escaper
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestBytes(t *testing.T) {
+	var b strings.Builder
+	e := New(&b)
+	if err := e.LiteralBytes([]byte(`<a title="`)); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.ValueBytes([]byte(`a"b`)); err != nil {
+		t.Fatal(err)
+	}
+	e.Literal(`"><script>var x = `)
+	e.ValueBytes([]byte("</script>"))
+	e.Literal(";</script>")
+	if got, want := b.String(), `<a title="a&#34;b"><script>var x = "\u003c/script\u003e";</script>`; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+// TestBytesNotRetained checks that nothing from the byte slices passed to
+// LiteralBytes is kept after it returns.
+func TestBytesNotRetained(t *testing.T) {
+	tests := []struct {
+		name  string
+		setup func(e *Escaper)
+		bytes string
+		rest  string
+		want  string
+	}{
+		{
+			"tag name",
+			nil,
+			"<textarea",
+			"></textarea>",
+			"<textarea></textarea>",
+		},
+		{
+			"sanitizer URL",
+			func(e *Escaper) { e.AllowedTags = map[string]bool{"a": true} },
+			`<a href="java`,
+			`script:alert(1)">x</a>`,
+			`<a href="#ZgotmplZ">x</a>`,
+		},
+		{
+			"open elements",
+			func(e *Escaper) { e.CheckTagBalance = true },
+			"<section>",
+			"</section>",
+			"<section></section>",
+		},
+	}
+	for _, tt := range tests {
+		var b strings.Builder
+		e := New(&b)
+		if tt.setup != nil {
+			tt.setup(e)
+		}
+		buf := []byte(tt.bytes)
+		if err := e.LiteralBytes(buf); err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		for i := range buf {
+			buf[i] = 'X'
+		}
+		e.Literal(tt.rest)
+		if err := e.Finish(); err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+		}
+		if got := b.String(); got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package escaper
+
+import "sync"
+
+// A CompiledTemplate is a sequence of pieces of literal HTML, with slots for
+// values between them. When it is written with PrintTemplate, the effect of
+// each piece of literal HTML on the escaping context is remembered, so that
+// the next time it is written in the same context, it does not need to be
+// parsed again.
+//
+// A CompiledTemplate may be used by multiple goroutines at once.
+type CompiledTemplate struct {
+	literals []string
+
+	mu sync.Mutex
+	// after[i] maps the context before literals[i] to the context after it.
+	after []map[ContextInfo]ContextInfo
+}
+
+// Compile returns a CompiledTemplate made of literals, with a value slot
+// between each pair of them. For example,
+//
+//	Compile(`<a href="`, `">`, `</a>`)
+//
+// has two value slots, for the URL and the link text.
+func Compile(literals ...string) *CompiledTemplate {
+	t := &CompiledTemplate{
+		literals: literals,
+		after:    make([]map[ContextInfo]ContextInfo, len(literals)),
+	}
+	for i := range t.after {
+		t.after[i] = make(map[ContextInfo]ContextInfo)
+	}
+	return t
+}
+
+// PrintTemplate writes t, with values filling its value slots. The values
+// are escaped just as they would be by Print.
+func (e *Escaper) PrintTemplate(t *CompiledTemplate, values ...interface{}) error {
+	slots := len(t.literals) - 1
+	if slots < 0 {
+		slots = 0
+	}
+	if len(values) != slots {
+		return errorf(ErrBadArg, "template has %d value slots, but %d values were passed", slots, len(values))
+	}
+	for i, lit := range t.literals {
+		if i > 0 {
+			if err := e.Value(values[i-1]); err != nil {
+				return err
+			}
+		}
+		if err := e.compiledLiteral(t, i, lit); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// compiledLiteral writes lit, which is t.literals[i], using the memoized
+// context transition if there is one.
+func (e *Escaper) compiledLiteral(t *CompiledTemplate, i int, lit string) error {
+	if e.NormalizeVoidElements || e.MaxAttributes > 0 || e.Indent != "" || e.CheckTagBalance || e.AllowedTags != nil || e.AutoNonce || e.Trace != nil || e.StripComments || e.XML {
+		// These features need to see the literal as it is parsed.
+		return e.Literal(lit)
+	}
+	if err := e.stickyError(); err != nil {
+		return err
+	}
+
+	before := e.Context()
+	t.mu.Lock()
+	after, ok := t.after[i][before]
+	t.mu.Unlock()
+	if ok {
+		e.RestoreContext(after)
+		e.advance(lit)
+		_, err := e.writeString(lit)
+		return err
+	}
+
+	if err := e.Literal(lit); err != nil {
+		return err
+	}
+	t.mu.Lock()
+	t.after[i][before] = e.Context()
+	t.mu.Unlock()
+	return nil
+}
@@ -0,0 +1,142 @@
+package escaper
+
+import (
+	"io"
+	"strings"
+	"testing"
+)
+
+// interleave returns literals with values between them, the way they are
+// passed to Print.
+func interleave(literals []string, values []interface{}) []interface{} {
+	args := []interface{}{literals[0]}
+	for i, v := range values {
+		args = append(args, v, literals[i+1])
+	}
+	return args
+}
+
+func TestPrintTemplate(t *testing.T) {
+	tests := []struct {
+		name     string
+		literals []string
+		values   [][]interface{}
+	}{
+		{
+			"link",
+			[]string{`<a href="`, `">`, `</a>`},
+			[][]interface{}{
+				{"/x", "<b>"},
+				{"javascript:alert(1)", "a & b"},
+				{"/y?q=a b", `"`},
+			},
+		},
+		{
+			"script",
+			[]string{"<script>var x = ", ", y = '", "';</script><p>", "</p>"},
+			[][]interface{}{
+				{1, "a'b", "<p>"},
+				{"</script>", "\\", "x"},
+			},
+		},
+		{
+			"context depends on value",
+			[]string{"<p ", ">", "</p>"},
+			[][]interface{}{
+				{"title", "x"},
+				{"onclick", "y"},
+			},
+		},
+		{
+			"no slots",
+			[]string{"<p>Hello</p>"},
+			[][]interface{}{{}, {}},
+		},
+	}
+	setups := []struct {
+		name  string
+		setup func(e *Escaper)
+	}{
+		{"default", nil},
+		{"NormalizeVoidElements", func(e *Escaper) { e.NormalizeVoidElements = true; e.XHTML = true }},
+		{"Indent", func(e *Escaper) { e.Indent = "  " }},
+		{"Nonce", func(e *Escaper) { e.AutoNonce = true; e.Nonce = "n" }},
+	}
+	for _, s := range setups {
+		for _, tt := range tests {
+			ct := Compile(tt.literals...)
+			// Each set of values is written twice, so that the second
+			// time uses the memoized contexts.
+			for pass := 0; pass < 2; pass++ {
+				for _, values := range tt.values {
+					want, wantErr := render(s.setup, interleave(tt.literals, values)...)
+					var b strings.Builder
+					e := New(&b)
+					if s.setup != nil {
+						s.setup(e)
+					}
+					err := e.PrintTemplate(ct, values...)
+					if (err == nil) != (wantErr == nil) {
+						t.Errorf("%s, %s: PrintTemplate error %v, Print error %v", s.name, tt.name, err, wantErr)
+						continue
+					}
+					if got := b.String(); got != want {
+						t.Errorf("%s, %s, pass %d: PrintTemplate wrote %q, Print wrote %q", s.name, tt.name, pass, got, want)
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestPrintTemplateErrors(t *testing.T) {
+	ct := Compile(`<a href="`, `">`, `</a>`)
+	e := New(io.Discard)
+	if err := e.PrintTemplate(ct, "/x"); err == nil {
+		t.Error("no error for too few values")
+	}
+	if err := e.PrintTemplate(ct, "/x", "y", "z"); err == nil {
+		t.Error("no error for too many values")
+	}
+
+	// A memoized literal still returns the error that put e in the error
+	// state.
+	bad := Compile(`<a href="x"<`)
+	for i := 0; i < 2; i++ {
+		e := New(io.Discard)
+		if err := e.PrintTemplate(bad); err == nil {
+			t.Errorf("pass %d: no error for malformed template", i)
+		}
+	}
+}
+
+var benchLiterals = []string{
+	`<li class="item"><a href="/items/`,
+	`" title="`,
+	`">`,
+	`</a> <span class="price">`,
+	`</span><script>track(`,
+	`);</script></li>`,
+}
+
+var benchValues = []interface{}{"1234", "A <fine> item", "Item name", 12.5, "item-1234"}
+
+func BenchmarkPrint(b *testing.B) {
+	e := New(io.Discard)
+	args := interleave(benchLiterals, benchValues)
+	for i := 0; i < b.N; i++ {
+		if err := e.Print(args...); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkPrintTemplate(b *testing.B) {
+	e := New(io.Discard)
+	ct := Compile(benchLiterals...)
+	for i := 0; i < b.N; i++ {
+		if err := e.PrintTemplate(ct, benchValues...); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -10,6 +10,61 @@ import (
 	"reflect"
 )
 
+// These types mark strings as trusted content of a particular kind, which
+// is written without escaping (or with less escaping) in the matching
+// context. They are the same types as the ones in html/template, so values
+// of either can be used, and programs don't need to import html/template
+// just to mark trusted content. The package documentation for html/template
+// describes what each type must contain to be safe.
+//
+// Values of other types can be marked as trusted with a method such as
+// SafeHTML() string; see toTrusted.
+type (
+	// CSS is a trusted CSS stylesheet, rule, or declaration.
+	CSS = template.CSS
+	// HTML is a trusted HTML document fragment.
+	HTML = template.HTML
+	// HTMLAttr is a trusted HTML attribute, such as ` dir="ltr"`.
+	HTMLAttr = template.HTMLAttr
+	// JS is a trusted JavaScript expression.
+	JS = template.JS
+	// JSStr is a trusted sequence of characters for a quoted JavaScript
+	// string.
+	JSStr = template.JSStr
+	// URL is a trusted URL.
+	URL = template.URL
+	// Srcset is a trusted srcset attribute value.
+	Srcset = template.Srcset
+)
+
+// toTrusted converts a value with a SafeHTML, SafeCSS, SafeJS, SafeJSStr,
+// SafeURL, SafeHTMLAttr, or SafeSrcset method (checked in that order) that
+// returns a string to the matching trusted content type. This lets types
+// such as a sanitized Markdown document or a validated URL declare that their
+// contents are trusted. Other values are returned unchanged.
+func toTrusted(a interface{}) interface{} {
+	if v := reflect.ValueOf(a); v.Kind() == reflect.Ptr && v.IsNil() {
+		return a
+	}
+	switch t := a.(type) {
+	case interface{ SafeHTML() string }:
+		return template.HTML(t.SafeHTML())
+	case interface{ SafeCSS() string }:
+		return template.CSS(t.SafeCSS())
+	case interface{ SafeJS() string }:
+		return template.JS(t.SafeJS())
+	case interface{ SafeJSStr() string }:
+		return template.JSStr(t.SafeJSStr())
+	case interface{ SafeURL() string }:
+		return template.URL(t.SafeURL())
+	case interface{ SafeHTMLAttr() string }:
+		return template.HTMLAttr(t.SafeHTMLAttr())
+	case interface{ SafeSrcset() string }:
+		return template.Srcset(t.SafeSrcset())
+	}
+	return a
+}
+
 type contentType uint8
 
 const (
@@ -20,6 +75,7 @@ const (
 	contentTypeJS
 	contentTypeJSStr
 	contentTypeURL
+	contentTypeSrcset
 	// contentTypeUnsafe is used in attr.go for values that affect how
 	// embedded content and network messages are formed, vetted,
 	// or interpreted; or which credentials network messages carry.
@@ -66,7 +122,7 @@ func indirectToStringerOrError(a interface{}) interface{} {
 // All pointers are dereferenced, as in the text/template package.
 func stringify(args ...interface{}) (string, contentType) {
 	if len(args) == 1 {
-		switch s := indirect(args[0]).(type) {
+		switch s := indirect(toTrusted(args[0])).(type) {
 		case string:
 			return s, contentTypePlain
 		case template.CSS:
@@ -81,6 +137,8 @@ func stringify(args ...interface{}) (string, contentType) {
 			return string(s), contentTypeJSStr
 		case template.URL:
 			return string(s), contentTypeURL
+		case template.Srcset:
+			return string(s), contentTypeSrcset
 		}
 	}
 	for i, arg := range args {
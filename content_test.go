@@ -0,0 +1,58 @@
+package escaper
+
+import "testing"
+
+func TestContentTypes(t *testing.T) {
+	runValueTests(t, nil, []valueTest{
+		{"HTML", "<p>", "</p>", HTML("<b>x</b>"), "<p><b>x</b></p>"},
+		{"HTML in attribute", `<p title="`, `">`, HTML("<b>x</b>"), `<p title="x">`},
+		{"CSS", "<style>", "</style>", CSS("p { color: red }"), "<style>p { color: red }</style>"},
+		{"HTMLAttr", "<p", ">", HTMLAttr(` dir="ltr"`), `<p dir="ltr">`},
+		{"JS", "<script>var x = ", ";</script>", JS(`{"a":1}`), `<script>var x = {"a":1};</script>`},
+		{"JSStr", `<script>var x = "`, `";</script>`, JSStr(`a<`), `<script>var x = "a\x3c";</script>`},
+		{"URL", `<a href="`, `">`, URL("javascript:f()"), `<a href="javascript:f%28%29">`},
+		{"URL in text", "<p>", "</p>", URL("<x>"), "<p>&lt;x&gt;</p>"},
+		{"Srcset", `<img srcset="`, `">`, Srcset("a.png 1x, b.png q"), `<img srcset="a.png 1x, b.png q">`},
+		{"pointer", "<p>", "</p>", func() *HTML { h := HTML("<b>"); return &h }(), "<p><b></p>"},
+	})
+}
+
+type safeHTML string
+
+func (s safeHTML) SafeHTML() string { return string(s) }
+
+type safeURL struct{ u string }
+
+func (s *safeURL) SafeURL() string { return s.u }
+
+type safeJS string
+
+func (s safeJS) SafeJS() string { return string(s) }
+
+type safeCSS string
+
+func (s safeCSS) SafeCSS() string { return string(s) }
+
+type safeAttr string
+
+func (s safeAttr) SafeHTMLAttr() string { return string(s) }
+
+type safeBoth string
+
+func (s safeBoth) SafeHTML() string { return "<b>" + string(s) + "</b>" }
+func (s safeBoth) SafeURL() string  { return "javascript:" + string(s) }
+
+func TestSafeMethods(t *testing.T) {
+	var nilURL *safeURL
+	runValueTests(t, nil, []valueTest{
+		{"SafeHTML", "<p>", "</p>", safeHTML("<b>x</b>"), "<p><b>x</b></p>"},
+		{"SafeHTML in script", "<script>var x = ", ";</script>", safeHTML("<b>"), `<script>var x = "\u003cb\u003e";</script>`},
+		{"SafeURL", `<a href="`, `">`, &safeURL{"javascript:f"}, `<a href="javascript:f">`},
+		{"nil SafeURL", `<a href="`, `">`, nilURL, `<a href="%3Cnil%3E">`},
+		{"SafeJS", "<script>var x = ", ";</script>", safeJS("f(1)"), "<script>var x = f(1);</script>"},
+		{"SafeCSS", "<style>", "</style>", safeCSS("p { color: red }"), "<style>p { color: red }</style>"},
+		{"SafeHTMLAttr", "<p", ">", safeAttr(` dir="ltr"`), `<p dir="ltr">`},
+		{"SafeHTML wins", "<p>", "</p>", safeBoth("x"), "<p><b>x</b></p>"},
+		{"SafeHTML wins in URL", `<a href="`, `">`, safeBoth("x"), `<a href="%3Cb%3Ex%3C/b%3E">`},
+	})
+}
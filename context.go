@@ -40,6 +40,90 @@ func (c context) eq(d context) bool {
 		c.err == d.err
 }
 
+// A ContextInfo is a snapshot of the state of an Escaper's HTML parser.
+// ContextInfo values are comparable; if two of them are equal, the same
+// markup will be parsed the same way and the same values will be escaped the
+// same way in both contexts.
+type ContextInfo struct {
+	c   context
+	tag tagInfo
+}
+
+func (ci ContextInfo) String() string {
+	return ci.c.String()
+}
+
+// InText reports whether the parser is in HTML text, outside any tag,
+// comment, or special element such as script.
+func (ci ContextInfo) InText() bool {
+	return ci.c.state == stateText
+}
+
+// InTag reports whether the parser is inside a tag, including its attribute
+// values.
+func (ci ContextInfo) InTag() bool {
+	return isInTag(ci.c.state) || ci.c.delim != delimNone
+}
+
+// InAttr reports whether the parser is inside an attribute value.
+func (ci ContextInfo) InAttr() bool {
+	return ci.c.delim != delimNone
+}
+
+// InScript reports whether the parser is in JavaScript, either in a script
+// element or in an event handler attribute.
+func (ci ContextInfo) InScript() bool {
+	return stateJS <= ci.c.state && ci.c.state <= stateJSLineCmt
+}
+
+// InStyle reports whether the parser is in CSS, either in a style element or
+// in a style attribute.
+func (ci ContextInfo) InStyle() bool {
+	return stateCSS <= ci.c.state && ci.c.state <= stateCSSLineCmt
+}
+
+// InURL reports whether the parser is in a URL, in an attribute such as href
+// or srcset, or in a CSS url(...).
+func (ci ContextInfo) InURL() bool {
+	switch ci.c.state {
+	case stateURL, stateSrcset, stateCSSDqURL, stateCSSSqURL, stateCSSURL:
+		return true
+	}
+	return false
+}
+
+// InComment reports whether the parser is in an HTML, JavaScript, or CSS
+// comment.
+func (ci ContextInfo) InComment() bool {
+	return isComment(ci.c.state)
+}
+
+// Element returns the lowercase name of the element whose tag or special
+// content (as in a script, style, textarea, or title element) the parser is
+// in, or "" if it is not in either.
+func (ci ContextInfo) Element() string {
+	if ci.InTag() || ci.c.element != elementNone {
+		return ci.tag.name
+	}
+	return ""
+}
+
+// InTemplate reports whether the parser is inside a template element. The
+// content of a template element is inert, but it is parsed as HTML, so it is
+// escaped the same way as content outside it.
+func (ci ContextInfo) InTemplate() bool {
+	return ci.tag.templates > 0
+}
+
+// Err returns the error that put the parser into its error state, or nil.
+func (ci ContextInfo) Err() error {
+	if ci.c.err == nil {
+		// Don't return a nil *Error as a non-nil error.
+		return nil
+	}
+	return ci.c.err
+}
+
 // mangle produces an identifier that includes a suffix that distinguishes it
 // from template names mangled with different contexts.
 func (c context) mangle(templateName string) string {
@@ -82,6 +166,12 @@ const (
 	// this state when its parse position is outside an HTML tag,
 	// directive, comment, and special element body.
 	stateText state = iota
+	// stateTagOpen occurs after a "<" at the end of some text, where a tag
+	// name may follow.
+	stateTagOpen
+	// stateEndTagOpen occurs after a "</" at the end of some text, where an
+	// end tag name may follow.
+	stateEndTagOpen
 	// stateTag occurs before an HTML attribute or the end of a tag.
 	stateTag
 	// stateAttrName occurs inside an attribute name.
@@ -95,6 +185,13 @@ const (
 	stateBeforeValue
 	// stateHTMLCmt occurs inside an <!-- HTML comment -->.
 	stateHTMLCmt
+	// stateBogusCmt occurs inside a <!DOCTYPE ...> declaration, or inside
+	// something that HTML parsers treat as a bogus comment, such as <!x>,
+	// <?x?>, or </ x>. Unlike an HTML comment, it ends at the first '>'.
+	stateBogusCmt
+	// stateCDATA occurs inside a <![CDATA[ section ]]> in foreign content
+	// (SVG or MathML). Elsewhere, "<![CDATA[" starts a bogus comment.
+	stateCDATA
 	// stateRCDATA occurs inside an RCDATA element (<textarea> or <title>)
 	// as described at http://www.w3.org/TR/html5/syntax.html#elements-0
 	stateRCDATA
@@ -102,6 +199,8 @@ const (
 	stateAttr
 	// stateURL occurs inside an HTML attribute whose content is a URL.
 	stateURL
+	// stateSrcset occurs inside an HTML srcset attribute.
+	stateSrcset
 	// stateJS occurs inside an event handler or script element.
 	stateJS
 	// stateJSDqStr occurs inside a JavaScript double quoted string.
@@ -137,14 +236,19 @@ const (
 
 var stateNames = [...]string{
 	stateText:        "stateText",
+	stateTagOpen:     "stateTagOpen",
+	stateEndTagOpen:  "stateEndTagOpen",
 	stateTag:         "stateTag",
 	stateAttrName:    "stateAttrName",
 	stateAfterName:   "stateAfterName",
 	stateBeforeValue: "stateBeforeValue",
 	stateHTMLCmt:     "stateHTMLCmt",
+	stateBogusCmt:    "stateBogusCmt",
+	stateCDATA:       "stateCDATA",
 	stateRCDATA:      "stateRCDATA",
 	stateAttr:        "stateAttr",
 	stateURL:         "stateURL",
+	stateSrcset:      "stateSrcset",
 	stateJS:          "stateJS",
 	stateJSDqStr:     "stateJSDqStr",
 	stateJSSqStr:     "stateJSSqStr",
@@ -173,7 +277,7 @@ func (s state) String() string {
 // authors & maintainers, not for end-users or machines.
 func isComment(s state) bool {
 	switch s {
-	case stateHTMLCmt, stateJSBlockCmt, stateJSLineCmt, stateCSSBlockCmt, stateCSSLineCmt:
+	case stateHTMLCmt, stateBogusCmt, stateJSBlockCmt, stateJSLineCmt, stateCSSBlockCmt, stateCSSLineCmt:
 		return true
 	}
 	return false
@@ -293,6 +397,9 @@ const (
 	elementTextarea
 	// elementTitle corresponds to the RCDATA <title> element.
 	elementTitle
+	// elementJSONScript corresponds to a <script> element whose type is
+	// JSON, so it contains data instead of code.
+	elementJSONScript
 )
 
 var elementNames = [...]string{
@@ -301,6 +408,8 @@ var elementNames = [...]string{
 	elementStyle:    "elementStyle",
 	elementTextarea: "elementTextarea",
 	elementTitle:    "elementTitle",
+
+	elementJSONScript: "elementJSONScript",
 }
 
 func (e element) String() string {
@@ -323,6 +432,13 @@ const (
 	attrStyle
 	// attrURL corresponds to an attribute whose value is a URL.
 	attrURL
+	// attrSrcset corresponds to a srcset attribute.
+	attrSrcset
+	// attrLang corresponds to an attribute whose value is a language tag,
+	// such as lang or hreflang.
+	attrLang
+	// attrScriptType corresponds to the type attribute of a script element.
+	attrScriptType
 )
 
 var attrNames = [...]string{
@@ -330,6 +446,10 @@ var attrNames = [...]string{
 	attrScript: "attrScript",
 	attrStyle:  "attrStyle",
 	attrURL:    "attrURL",
+	attrSrcset: "attrSrcset",
+	attrLang:   "attrLang",
+
+	attrScriptType: "attrScriptType",
 }
 
 func (a attr) String() string {
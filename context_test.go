@@ -0,0 +1,117 @@
+package escaper
+
+import (
+	"io"
+	"testing"
+)
+
+func TestLiteralDelta(t *testing.T) {
+	tests := []struct {
+		literal string
+		after   context
+	}{
+		{"<p>", context{state: stateText}},
+		{`<a href="`, context{state: stateURL, delim: delimDoubleQuote, attr: attrURL}},
+		{"/x?", context{state: stateURL, delim: delimDoubleQuote, urlPart: urlPartQueryOrFrag, attr: attrURL}},
+		{`">`, context{state: stateText}},
+		{"<script>", context{state: stateJS, element: elementScript}},
+		{"var x = 1", context{state: stateJS, jsCtx: jsCtxDivOp, element: elementScript}},
+		{"</script>", context{state: stateText}},
+	}
+	e := New(io.Discard)
+	prev := e.Context()
+	for _, tt := range tests {
+		before, after, err := e.LiteralDelta(tt.literal)
+		if err != nil {
+			t.Fatalf("%q: %v", tt.literal, err)
+		}
+		if !before.c.eq(prev.c) {
+			t.Errorf("%q: before = %v, want %v", tt.literal, before, prev)
+		}
+		if !after.c.eq(tt.after) {
+			t.Errorf("%q: after = %v, want %v", tt.literal, after, tt.after)
+		}
+		if got := e.Context(); !got.c.eq(after.c) {
+			t.Errorf("%q: Context() = %v, after = %v", tt.literal, got, after)
+		}
+
+		// Replaying the literal from before should reach the same context.
+		r := New(io.Discard)
+		r.RestoreContext(before)
+		r.Literal(tt.literal)
+		if got := r.Context(); !got.c.eq(after.c) {
+			t.Errorf("%q: replayed context = %v, want %v", tt.literal, got, after)
+		}
+		prev = after
+	}
+
+	_, after, err := e.LiteralDelta(`<a href="x"<`)
+	if err == nil {
+		t.Fatal("no error from bad literal")
+	}
+	if after.c.state != stateError {
+		t.Errorf("after error: got %v, want error state", after)
+	}
+}
+
+func TestContextInfo(t *testing.T) {
+	type flags struct {
+		text, tag, attr, script, style, url, comment, template bool
+		element                                                string
+	}
+	tests := []struct {
+		html string
+		want flags
+	}{
+		{"", flags{text: true}},
+		{"<p>", flags{text: true}},
+		{"<p", flags{tag: true, element: "p"}},
+		{`<p title="`, flags{tag: true, attr: true, element: "p"}},
+		{`<a href="`, flags{tag: true, attr: true, url: true, element: "a"}},
+		{`<img srcset="`, flags{tag: true, attr: true, url: true, element: "img"}},
+		{`<a onclick="`, flags{tag: true, attr: true, script: true, element: "a"}},
+		{`<a onclick="/* `, flags{tag: true, attr: true, script: true, comment: true, element: "a"}},
+		{"<script>", flags{script: true, element: "script"}},
+		{"<script>var s = '", flags{script: true, element: "script"}},
+		{"<script>// ", flags{script: true, comment: true, element: "script"}},
+		{"<style>", flags{style: true, element: "style"}},
+		{"<style>p { background: url(", flags{style: true, url: true, element: "style"}},
+		{`<p style="`, flags{tag: true, attr: true, style: true, element: "p"}},
+		{"<!-- ", flags{comment: true}},
+		{"<textarea>", flags{element: "textarea"}},
+		{"<title>", flags{element: "title"}},
+		{"<template><p>", flags{text: true, template: true}},
+		{"<template></template>", flags{text: true}},
+	}
+	for _, tt := range tests {
+		e := New(io.Discard)
+		if err := e.Literal(tt.html); err != nil {
+			t.Errorf("%q: %v", tt.html, err)
+			continue
+		}
+		ci := e.Context()
+		got := flags{
+			text:     ci.InText(),
+			tag:      ci.InTag(),
+			attr:     ci.InAttr(),
+			script:   ci.InScript(),
+			style:    ci.InStyle(),
+			url:      ci.InURL(),
+			comment:  ci.InComment(),
+			template: ci.InTemplate(),
+			element:  ci.Element(),
+		}
+		if got != tt.want {
+			t.Errorf("%q: got %+v, want %+v", tt.html, got, tt.want)
+		}
+		if ci.Err() != nil {
+			t.Errorf("%q: Err() = %v", tt.html, ci.Err())
+		}
+	}
+
+	e := New(io.Discard)
+	err := e.Literal(`<a href="x"<`)
+	if got := e.Context().Err(); got == nil || got != err {
+		t.Errorf("after error: Err() = %v, want %v", got, err)
+	}
+}
@@ -181,6 +181,50 @@ func cssEscaper(args ...interface{}) string {
 	return b.String()
 }
 
+// cssIdentEscaper escapes its input so that it can be used as a CSS
+// identifier, such as a class name or a custom property name, following the
+// "serialize an identifier" algorithm from CSSOM. Characters that are not
+// allowed in identifiers are written as \<hex>+ escapes, so the output can
+// be embedded in HTML attributes without further encoding.
+func cssIdentEscaper(args ...interface{}) string {
+	s, _ := stringify(args...)
+	var b bytes.Buffer
+	r, w, written := rune(0), 0, 0
+	for i := 0; i < len(s); i += w {
+		r, w = utf8.DecodeRuneInString(s[i:])
+		switch {
+		case r == 0:
+			b.WriteString(s[written:i])
+			b.WriteRune(utf8.RuneError)
+			written = i + w
+			continue
+		case '0' <= r && r <= '9':
+			// An identifier can't start with a digit, or with a hyphen
+			// and a digit.
+			if i != 0 && (i != 1 || s[0] != '-') {
+				continue
+			}
+		case r == '-':
+			if len(s) > 1 {
+				continue
+			}
+		case r >= 0x80 || r == '_' || 'a' <= r && r <= 'z' || 'A' <= r && r <= 'Z':
+			continue
+		}
+		b.WriteString(s[written:i])
+		fmt.Fprintf(&b, "\\%x", r)
+		written = i + w
+		if written == len(s) || isHex(s[written]) || isCSSSpace(s[written]) {
+			b.WriteByte(' ')
+		}
+	}
+	if written == 0 {
+		return s
+	}
+	b.WriteString(s[written:])
+	return b.String()
+}
+
 var cssReplacementTable = []string{
 	0:    `\0`,
 	'\t': `\9`,
@@ -213,6 +257,15 @@ var mozBindingBytes = []byte("mozbinding")
 // (inherit, blue), and colors (#888).
 // It filters out unsafe values, such as those that affect token boundaries,
 // and anything that might execute scripts.
+// Values of custom properties, as in style="--x: {{.}}", are filtered the
+// same way: the custom property grammar is more permissive, but a value that
+// could end the declaration or the rule (';', '}') or the attribute is
+// rejected.
+// The same goes for values in at-rule preludes, as in "@media {{.}} {...}";
+// the CSS state machine doesn't track them separately, and the braces that
+// would start or end a rule are rejected everywhere. Media features in
+// parentheses are rejected too, so a media query from a trusted source
+// needs to be passed as template.CSS.
 func cssValueFilter(args ...interface{}) string {
 	s, t := stringify(args...)
 	if t == contentTypeCSS {
@@ -235,6 +288,11 @@ func cssValueFilter(args ...interface{}) string {
 		switch c {
 		case 0, '"', '\'', '(', ')', '/', ';', '@', '[', '\\', ']', '`', '{', '}':
 			return filterFailsafe
+		case '<':
+			// A <style> element inside <svg> is foreign content, not raw
+			// text, so a '<' there could start a tag that breaks out of
+			// the SVG.
+			return filterFailsafe
 		case '-':
 			// Disallow <!-- or -->.
 			// -- should not appear in valid identifiers.
@@ -0,0 +1,105 @@
+package escaper
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCSSCustomProperty(t *testing.T) {
+	runValueTests(t, nil, []valueTest{
+		{"color", `<p style="--x: `, `">`, "red", `<p style="--x: red">`},
+		{"rule breakout", `<p style="--x: `, `">`, "red} body{color:red", `<p style="--x: ZgotmplZ">`},
+		{"attribute breakout", `<p style="--x: `, `">`, `red" onclick="alert(1)`, `<p style="--x: ZgotmplZ">`},
+		{"expression", `<p style="--x: `, `">`, "expression(alert(1))", `<p style="--x: ZgotmplZ">`},
+		{"quoted string", `<p style="--x: '`, `'">`, `a'}"<`, `<p style="--x: 'a\27\7d\22\3c '">`},
+	})
+}
+
+func TestCSSIdentEscaper(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"color", "color"},
+		{"--my-var", "--my-var"},
+		{"--my prop", `--my\20prop`},
+		{"--my face", `--my\20 face`},
+		{"1col", `\31 col`},
+		{"-1col", `-\31 col`},
+		{"col1", "col1"},
+		{"-", `\2d `},
+		{"a.b", `a\2e b`},
+		{"a:b", `a\3a b`},
+		{`a"b`, `a\22 b`},
+		{"a;}", `a\3b\7d `},
+		{"a<b", `a\3c b`},
+		{"café", "café"},
+		{"日本", "日本"},
+		{"a\x00b", "a�b"},
+		{"_x", "_x"},
+	}
+	for _, tt := range tests {
+		if got := cssIdentEscaper(tt.in); got != tt.want {
+			t.Errorf("cssIdentEscaper(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestStyleMapNames(t *testing.T) {
+	var b strings.Builder
+	e := New(&b)
+	e.Literal("<p")
+	err := e.StyleMap(map[string]interface{}{
+		"--my prop": "red",
+		"1x":        "1px",
+		"color":     "blue",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	e.Literal(">")
+	if got, want := b.String(), `<p style="--my\20prop: red; \31x: 1px; color: blue">`; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	e = New(&b)
+	e.Literal("<p")
+	if err := e.StyleMap(map[string]interface{}{"": "red"}); err == nil {
+		t.Error("no error for empty property name")
+	}
+
+	// A List value is escaped as a value, not written as literal HTML.
+	b.Reset()
+	e = New(&b)
+	e.Literal("<p")
+	if err := e.StyleMap(map[string]interface{}{"color": List{"red", `"><script>alert(1)</script>`}}); err != nil {
+		t.Fatal(err)
+	}
+	e.Literal(">")
+	if got, want := b.String(), `<p style="color: ZgotmplZ">`; got != want {
+		t.Errorf("List value: got %q, want %q", got, want)
+	}
+}
+
+func TestCSSMediaQuery(t *testing.T) {
+	runValueTests(t, nil, []valueTest{
+		{"media type", "<style>@media ", " { p { color: red } }</style>", "screen", "<style>@media screen { p { color: red } }</style>"},
+		{"rule breakout", "<style>@media ", " {}</style>", "screen {} body { display:none } @media all", "<style>@media ZgotmplZ {}</style>"},
+		{"semicolon", "<style>@media ", " {}</style>", "screen; @import url(x)", "<style>@media ZgotmplZ {}</style>"},
+		{"end tag", "<style>@media ", " {}</style>", "</style><script>", "<style>@media ZgotmplZ {}</style>"},
+		{"comment", "<style>@media ", " {}</style>", "/**/", "<style>@media ZgotmplZ {}</style>"},
+		{"feature", "<style>@media (max-width: ", ") {}</style>", "600px", "<style>@media (max-width: 600px) {}</style>"},
+		{"feature breakout", "<style>@media (max-width: ", ") {}</style>", "1px) { body { display: none } ", "<style>@media (max-width: ZgotmplZ) {}</style>"},
+		{"style attribute", `<p style="@media `, `">`, "a{b}", `<p style="@media ZgotmplZ">`},
+	})
+}
+
+func TestSVGStyle(t *testing.T) {
+	runValueTests(t, nil, []valueTest{
+		{"color", "<svg><style>circle { fill: ", " }</style></svg>", "red", "<svg><style>circle { fill: red }</style></svg>"},
+		{"end tag breakout", "<svg><style>circle { fill: ", " }</style></svg>", "</style><script>alert(1)</script>", "<svg><style>circle { fill: ZgotmplZ }</style></svg>"},
+		{"rule breakout", "<svg><style>circle { fill: ", " }</style></svg>", "red } * { display: none", "<svg><style>circle { fill: ZgotmplZ }</style></svg>"},
+		{"string", "<svg><style>text::after { content: '", "' }</style></svg>", "</style><script>", `<svg><style>text::after { content: '\3c\2fstyle\3e\3cscript\3e ' }</style></svg>`},
+		{"after style", "<svg><style>circle { fill: red }</style><text>", "</text></svg>", "<b>", "<svg><style>circle { fill: red }</style><text>&lt;b&gt;</text></svg>"},
+		{"style attribute", `<svg><circle style="fill: `, `"/></svg>`, "red;} x", `<svg><circle style="fill: ZgotmplZ"/></svg>`},
+	})
+}
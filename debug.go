@@ -0,0 +1,58 @@
+package escaper
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// commentSanitizer makes text safe to include in an HTML, JS, or CSS
+// comment.
+var commentSanitizer = strings.NewReplacer("<", "_", ">", "_", "--", "-_", "*/", "*_")
+
+// DebugMarker writes a comment describing the current context, if e.Debug is
+// set. It does nothing otherwise. For example, in HTML text it writes
+//
+//	<!-- escaper: state=Text delim=None elem=None attr=None (label) -->
+//
+// In a script or style element, it writes a /* block comment */ instead.
+// In other contexts, such as inside a tag or a JSON script element, a comment
+// can't be written, so it does nothing.
+func (e *Escaper) DebugMarker(label string) error {
+	if !e.Debug {
+		return nil
+	}
+	if err := e.stickyError(); err != nil {
+		return err
+	}
+	c := e.ctx
+	desc := fmt.Sprintf("escaper: state=%s delim=%s elem=%s attr=%s",
+		strings.TrimPrefix(c.state.String(), "state"),
+		strings.TrimPrefix(c.delim.String(), "delim"),
+		strings.TrimPrefix(c.element.String(), "element"),
+		strings.TrimPrefix(c.attr.String(), "attr"))
+	if label != "" {
+		desc += " (" + label + ")"
+	}
+	desc = commentSanitizer.Replace(desc)
+
+	switch {
+	case c.state == stateText:
+		return e.Literal("<!-- " + desc + " -->")
+	case c.delim == delimNone && (c.state == stateJS || c.state == stateCSS) && c.element != elementJSONScript:
+		// The leading space keeps a preceding slash from turning it
+		// into a line comment.
+		return e.Literal(" /* " + desc + " */ ")
+	}
+	return nil
+}
+
+// TraceWriter returns a function for Escaper.Trace that writes a line to w
+// for each state transition, such as
+//
+//	{stateText delimNone ...} -> {stateTag delimNone ...} "<a"
+func TraceWriter(w io.Writer) func(from, to ContextInfo, text string) {
+	return func(from, to ContextInfo, text string) {
+		fmt.Fprintf(w, "%v -> %v %q\n", from, to, text)
+	}
+}
@@ -0,0 +1,147 @@
+package escaper
+
+import (
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestDebugMarker(t *testing.T) {
+	tests := []struct {
+		before, want string
+	}{
+		{"<p>", "<p><!-- escaper: state=Text delim=None elem=None attr=None (x) -->"},
+		{"<script>", "<script> /* escaper: state=JS delim=None elem=Script attr=None (x) */ "},
+		{"<style>", "<style> /* escaper: state=CSS delim=None elem=Style attr=None (x) */ "},
+		{`<script type="application/json">`, `<script type="application/json">`},
+		{`<script type="importmap">`, `<script type="importmap">`},
+		{`<a title="`, `<a title="`},
+	}
+	for _, tt := range tests {
+		var b strings.Builder
+		e := New(&b)
+		e.Debug = true
+		e.Literal(tt.before)
+		if err := e.DebugMarker("x"); err != nil {
+			t.Errorf("%s: %v", tt.before, err)
+		}
+		if got := b.String(); got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.before, got, tt.want)
+		}
+	}
+}
+
+func TestDebugMarkerLabel(t *testing.T) {
+	tests := []struct {
+		before, label, want string
+	}{
+		{"<p>", "-->", "<p><!-- escaper: state=Text delim=None elem=None attr=None (-__) -->"},
+		{"<p>", "--!><b>", "<p><!-- escaper: state=Text delim=None elem=None attr=None (-_!__b_) -->"},
+		{"<script>", "*/ alert(1) /*", "<script> /* escaper: state=JS delim=None elem=Script attr=None (*_ alert(1) /*) */ "},
+		{"<script>", "</script>", "<script> /* escaper: state=JS delim=None elem=Script attr=None (_/script_) */ "},
+		{"<p>", "", "<p><!-- escaper: state=Text delim=None elem=None attr=None -->"},
+	}
+	for _, tt := range tests {
+		var b strings.Builder
+		e := New(&b)
+		e.Debug = true
+		e.Literal(tt.before)
+		if err := e.DebugMarker(tt.label); err != nil {
+			t.Errorf("%q: %v", tt.label, err)
+		}
+		if got := b.String(); got != tt.want {
+			t.Errorf("%q: got %q, want %q", tt.label, got, tt.want)
+		}
+		if got := e.Context(); got.InText() != (tt.before == "<p>") {
+			t.Errorf("%q: context %v after marker", tt.label, got)
+		}
+	}
+
+	// Without Debug, nothing is written.
+	var b strings.Builder
+	e := New(&b)
+	e.Literal("<p>")
+	if err := e.DebugMarker("x"); err != nil {
+		t.Error(err)
+	}
+	if got, want := b.String(), "<p>"; got != want {
+		t.Errorf("Debug off: got %q, want %q", got, want)
+	}
+}
+
+func TestTrace(t *testing.T) {
+	type step struct {
+		from, to state
+		text     string
+	}
+	var got []step
+	var b strings.Builder
+	e := New(&b)
+	e.Trace = func(from, to ContextInfo, text string) {
+		if from == to {
+			t.Errorf("Trace called without a state change for %q", text)
+		}
+		got = append(got, step{from.c.state, to.c.state, text})
+	}
+	e.Print(`<a href="/x?`, "v", `">t</a>`)
+
+	want := []step{
+		{stateText, stateTag, "<a"},
+		{stateTag, stateAfterName, " href"},
+		{stateAfterName, stateBeforeValue, "="},
+		{stateBeforeValue, stateURL, `"`},
+		{stateURL, stateURL, "/x?"},
+		{stateURL, stateTag, `"`},
+		{stateTag, stateText, ">"},
+		{stateText, stateTag, "t</a"},
+		{stateTag, stateText, ">"},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %d transitions %v, want %d", len(got), got, len(want))
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("transition %d: got %v, want %v", i, got[i], want[i])
+		}
+	}
+	if got, want := b.String(), `<a href="/x?v">t</a>`; got != want {
+		t.Errorf("output: got %q, want %q", got, want)
+	}
+}
+
+func TestTraceWriter(t *testing.T) {
+	var trace strings.Builder
+	var b strings.Builder
+	e := New(&b)
+	e.Trace = TraceWriter(&trace)
+	e.Literal("<b>")
+
+	lines := strings.Split(strings.TrimSuffix(trace.String(), "\n"), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("got %d lines, want 2:\n%s", len(lines), trace.String())
+	}
+	for i, text := range []string{`"<b"`, `">"`} {
+		if !strings.Contains(lines[i], " -> ") || !strings.HasSuffix(lines[i], " "+text) {
+			t.Errorf("line %d: got %q, want a transition ending in %s", i, lines[i], text)
+		}
+	}
+	if !strings.HasPrefix(lines[0], "{stateText ") {
+		t.Errorf("line 0: got %q, want it to start in stateText", lines[0])
+	}
+}
+
+func TestTraceLiteralBytes(t *testing.T) {
+	// The text passed to Trace must not change when the caller reuses the
+	// byte slice that was passed to LiteralBytes.
+	var texts []string
+	e := New(io.Discard)
+	e.Trace = func(from, to ContextInfo, text string) {
+		texts = append(texts, text)
+	}
+	buf := []byte("<b>")
+	e.LiteralBytes(buf)
+	copy(buf, "XXX")
+	if got, want := strings.Join(texts, ""), "<b>"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
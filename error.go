@@ -14,9 +14,20 @@ type Error struct {
 	ErrorCode ErrorCode
 	// Description is a human-readable description of the problem.
 	Description string
+
+	// Offset is the byte offset where the problem was found, in the HTML
+	// that was passed to the Escaper (counting both literal HTML and
+	// escaped values). Line and Column are the line number and the byte
+	// column, starting at 1, and Snippet is a short piece of the HTML
+	// there. They are zero if the position is unknown.
+	Offset  int64
+	Line    int
+	Column  int
+	Snippet string
 }
 
-// ErrorCode is a code for a kind of error.
+// ErrorCode is a code for a kind of error. An ErrorCode is also an error, so
+// that errors.Is can check whether an error is of a given kind.
 type ErrorCode int
 
 // We define codes for each error that manifests while escaping templates, but
@@ -54,12 +65,14 @@ const (
 	ErrAmbigContext
 
 	// ErrBadHTML: "expected space, attr name, or end of tag, but got ...",
-	//   "... in unquoted attr", "... in attribute name"
+	//   "... in unquoted attr", "... in attribute name",
+	//   "value in unquoted attribute value in <...>"
 	// Example:
 	//   <a href = /search?q=foo>
 	//   <href=foo>
 	//   <form na<e=...>
 	//   <option selected<
+	//   <a href={{.}}> (with Escaper.RequireQuotedAttrs)
 	// Discussion:
 	//   This is often due to a typo in an HTML element, but some runes
 	//   are banned in tag names, attribute names, and unquoted attribute
@@ -175,13 +188,173 @@ const (
 	//   Look for missing semicolons inside branches, and maybe add
 	//   parentheses to make it clear which interpretation you intend.
 	ErrSlashAmbig
+
+	// ErrBadArg: "invalid JS identifier ...", "invalid attribute name ...",
+	//   "invalid script type ...", "invalid pixel density ...",
+	//   "unsafe URL in srcset ...", "invalid media type ..."
+	// Example:
+	//   e.ConfigScript("config = evil(); x", cfg)
+	// Discussion:
+	//   Helper methods that write complete elements validate arguments,
+	//   such as variable names, that are written to the output without
+	//   escaping. These arguments should be constants in the program, not
+	//   data from users.
+	//
+	//   ErrBadArg is also returned when an *Escaper is passed to Value, and
+	//   when the arguments to Printf don't match the verbs in its format.
+	ErrBadArg
+
+	// ErrHelperContext: "... called in ..., not in HTML text",
+	//   "... called in ..., not in a start tag",
+	//   "CloseTag called in ..., not in HTML text or a ... element"
+	// Example:
+	//   e.Literal(`<a title="`)
+	//   e.ConfigScript("config", cfg)
+	// Discussion:
+	//   Helper methods can only be called in the context they are designed
+	//   for. Helpers that write complete elements must be called in HTML
+	//   text, where an element can start. Helpers that write attributes
+	//   must be called inside a start tag.
+	ErrHelperContext
+
+	// ErrBadValue: "... is not a valid language tag"
+	// Example:
+	//   <html lang="{{.}}">
+	//   where {{.}} evaluates to `en_US`
+	// Discussion:
+	//   The value was escaped safely, but it is not valid for the attribute
+	//   it was written into. This is only reported to Escaper.Warn, since
+	//   it is probably a bug, but not a security problem.
+	ErrBadValue
+
+	// ErrJSON: "cannot encode ... as JSON: ..."
+	// Example:
+	//   e.JSONLD(map[string]interface{}{"f": func() {}})
+	// Discussion:
+	//   Helpers that write JSON data islands need their argument to be
+	//   encodable by encoding/json. Unlike Value in a script, which writes
+	//   a JavaScript comment instead, they report the error, since the
+	//   output would not be valid JSON. So does Value in a script element
+	//   whose type is JSON, such as <script type="application/json">.
+	ErrJSON
+
+	// ErrAttrCount: "<...> has more than ... attributes",
+	//   "value ... expands into ... attributes"
+	// Example:
+	//   <a href="/" {{.}}>
+	//   where {{.}} evaluates to template.HTMLAttr(`class=x onclick=evil()`)
+	// Discussion:
+	//   This is only reported to Escaper.Warn, when Escaper.MaxAttributes
+	//   is set. A value that adds extra attributes to a tag may indicate
+	//   that untrusted data has been marked as safe by mistake.
+	ErrAttrCount
+
+	// ErrUnclosed: "unclosed elements: ..."
+	// Example:
+	//   <div><span>Hello</div>
+	// Discussion:
+	//   This is returned by Escaper.Finish when Escaper.CheckTagBalance is
+	//   set. It lists the elements that were still open at the end of the
+	//   output, or that were closed implicitly by the end tag of an element
+	//   that contains them.
+	ErrUnclosed
+
+	// ErrHeadersSent: "... called after the response has started",
+	//   "... called on an Escaper that is not from ForHTTP"
+	// Example:
+	//   e, c := escaper.ForHTTP(w, r)
+	//   e.Literal("<p>")
+	//   e.Status(http.StatusNotFound)
+	// Discussion:
+	//   Escaper.Status and Escaper.Discard only work before the status
+	//   and headers of the response have been sent. Use DeferHeaders,
+	//   Buffered, or MinCompressSize to hold the start of the response.
+	ErrHeadersSent
+
+	// ErrCommentValue: "value in ..."
+	// Example:
+	//   <!-- {{.}} -->
+	// Discussion:
+	//   This is only reported when Escaper.CommentValues is
+	//   RejectCommentValues. Otherwise values in comments are dropped, or
+	//   escaped and written.
+	ErrCommentValue
 )
 
 func (e *Error) Error() string {
-	return "htmlwriter: " + e.Description
+	if e.Line == 0 {
+		return "htmlwriter: " + e.Description
+	}
+	return fmt.Sprintf("htmlwriter: line %d, column %d: %s", e.Line, e.Column, e.Description)
+}
+
+// Is reports whether target is e's ErrorCode, so that the kind of an error
+// can be checked with errors.Is:
+//
+//	if errors.Is(err, escaper.ErrAmbigContext) {
+//
+// The details of an error can be retrieved with errors.As and an *Error.
+func (e *Error) Is(target error) bool {
+	c, ok := target.(ErrorCode)
+	return ok && c == e.ErrorCode
+}
+
+// errorCodeNames maps each ErrorCode to its name.
+var errorCodeNames = [...]string{
+	OK:                  "OK",
+	ErrAmbigContext:     "ErrAmbigContext",
+	ErrBadHTML:          "ErrBadHTML",
+	ErrBranchEnd:        "ErrBranchEnd",
+	ErrEndContext:       "ErrEndContext",
+	ErrNoSuchTemplate:   "ErrNoSuchTemplate",
+	ErrOutputContext:    "ErrOutputContext",
+	ErrPartialCharset:   "ErrPartialCharset",
+	ErrPartialEscape:    "ErrPartialEscape",
+	ErrRangeLoopReentry: "ErrRangeLoopReentry",
+	ErrSlashAmbig:       "ErrSlashAmbig",
+	ErrBadArg:           "ErrBadArg",
+	ErrHelperContext:    "ErrHelperContext",
+	ErrBadValue:         "ErrBadValue",
+	ErrJSON:             "ErrJSON",
+	ErrAttrCount:        "ErrAttrCount",
+	ErrUnclosed:         "ErrUnclosed",
+	ErrHeadersSent:      "ErrHeadersSent",
+	ErrCommentValue:     "ErrCommentValue",
 }
 
+func (c ErrorCode) String() string {
+	if 0 <= c && int(c) < len(errorCodeNames) {
+		return errorCodeNames[c]
+	}
+	return fmt.Sprintf("ErrorCode(%d)", int(c))
+}
+
+// Error makes each ErrorCode an error, so that the codes can be used as
+// targets for errors.Is.
+func (c ErrorCode) Error() string {
+	return "htmlwriter: " + c.String()
+}
+
+// An ErrorPolicy selects what an Escaper does when a value can't be escaped
+// or literal HTML can't be parsed.
+type ErrorPolicy int
+
+const (
+	// ReturnErrors makes the method that caused the error return it. The
+	// Escaper stays in the error state, so it keeps returning the same
+	// error. This is the default.
+	ReturnErrors ErrorPolicy = iota
+
+	// PanicOnError makes the Escaper panic with the error.
+	PanicOnError
+
+	// WriteFailsafe makes Value write "ZgotmplZ" instead of a value that
+	// can't be escaped, and carry on without returning an error. Errors in
+	// literal HTML are still returned, since they can't be repaired.
+	WriteFailsafe
+)
+
 // errorf creates an error given a format string f and args.
 func errorf(k ErrorCode, f string, args ...interface{}) *Error {
-	return &Error{k, fmt.Sprintf(f, args...)}
+	return &Error{ErrorCode: k, Description: fmt.Sprintf(f, args...)}
 }
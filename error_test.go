@@ -0,0 +1,191 @@
+package escaper
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestStrictErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		use  func(e *Escaper) error
+	}{
+		{"Literal", func(e *Escaper) error { return e.Literal("x") }},
+		{"Value", func(e *Escaper) error { return e.Value("x") }},
+		{"Print", func(e *Escaper) error { return e.Print("<p>", "x") }},
+	}
+	for _, tt := range tests {
+		e := New(io.Discard)
+		first := e.Literal(`<a href="x"<`)
+		if first == nil {
+			t.Fatalf("%s: no error from bad literal", tt.name)
+		}
+		if err := tt.use(e); err != first {
+			t.Errorf("%s: got %v after error, want %v", tt.name, err, first)
+		}
+
+		e = New(io.Discard)
+		e.StrictErrors = true
+		e.Literal(`<a href="x"<`)
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("%s: no panic after error with StrictErrors", tt.name)
+				}
+			}()
+			tt.use(e)
+		}()
+	}
+}
+
+func TestErrorPolicy(t *testing.T) {
+	tests := []struct {
+		name      string
+		policy    ErrorPolicy
+		wantErr   bool
+		wantPanic bool
+		want      string
+	}{
+		{"ReturnErrors", ReturnErrors, true, false, "<p><!-- "},
+		{"PanicOnError", PanicOnError, false, true, "<p><!-- "},
+		{"WriteFailsafe", WriteFailsafe, false, false, "<p><!-- ZgotmplZ --></p>"},
+	}
+	for _, tt := range tests {
+		var b strings.Builder
+		var reported []error
+		e := New(&b)
+		e.CommentValues = RejectCommentValues
+		e.ErrorPolicy = tt.policy
+		e.OnError = func(err error) { reported = append(reported, err) }
+
+		var err error
+		var panicked interface{}
+		func() {
+			defer func() { panicked = recover() }()
+			err = e.Print("<p><!-- ", "x", " --></p>")
+		}()
+
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: got error %v", tt.name, err)
+		}
+		if err != nil && !errors.Is(err, ErrCommentValue) {
+			t.Errorf("%s: got %v, want ErrCommentValue", tt.name, err)
+		}
+		if (panicked != nil) != tt.wantPanic {
+			t.Errorf("%s: got panic %v", tt.name, panicked)
+		}
+		if pe, ok := panicked.(error); tt.wantPanic && !(ok && errors.Is(pe, ErrCommentValue)) {
+			t.Errorf("%s: panicked with %v, want ErrCommentValue", tt.name, panicked)
+		}
+		if len(reported) != 1 || !errors.Is(reported[0], ErrCommentValue) {
+			t.Errorf("%s: OnError got %v", tt.name, reported)
+		}
+		if got := b.String(); got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+
+	// Errors in literal HTML are returned even with WriteFailsafe.
+	e := New(io.Discard)
+	e.ErrorPolicy = WriteFailsafe
+	if err := e.Literal(`<a href="x"<`); !errors.Is(err, ErrBadHTML) {
+		t.Errorf("WriteFailsafe with bad literal: got %v, want ErrBadHTML", err)
+	}
+}
+
+func TestErrorPosition(t *testing.T) {
+	tests := []struct {
+		name    string
+		write   func(e *Escaper) error
+		line    int
+		column  int
+		offset  int64
+		snippet string
+	}{
+		{
+			"first line",
+			func(e *Escaper) error { return e.Literal(`<a href="x"<b>`) },
+			1, 12, 11, `<a href="x"<b>`,
+		},
+		{
+			"later line",
+			func(e *Escaper) error {
+				e.Literal("<p>\nhello ")
+				e.Value("a<b")
+				return e.Literal(" x\n  <a href=\"x\"<b>")
+			},
+			3, 14, 32, " x\n  <a href=\"x\"<b>",
+		},
+		{
+			"newline in value",
+			func(e *Escaper) error {
+				e.Print("<pre>", "a\nb", "\n")
+				return e.Literal(`<a href="x"<b>`)
+			},
+			3, 12, 20, `<a href="x"<b>`,
+		},
+		{
+			"snippet",
+			func(e *Escaper) error {
+				return e.Literal(strings.Repeat("x", 30) + `<a href="x"<b>` + strings.Repeat("y", 40))
+			},
+			1, 42, 41, strings.Repeat("x", 5) + `<a href="x"<b>` + strings.Repeat("y", 29),
+		},
+		{
+			"value",
+			func(e *Escaper) error {
+				e.CommentValues = RejectCommentValues
+				e.Literal("<p>\n<!-- ")
+				return e.Value("x")
+			},
+			2, 6, 9, "",
+		},
+	}
+	for _, tt := range tests {
+		err := tt.write(New(io.Discard))
+		var pe *Error
+		if !errors.As(err, &pe) {
+			t.Errorf("%s: got %v", tt.name, err)
+			continue
+		}
+		if pe.Line != tt.line || pe.Column != tt.column || pe.Offset != tt.offset || pe.Snippet != tt.snippet {
+			t.Errorf("%s: got line %d, column %d, offset %d, snippet %q; want %d, %d, %d, %q", tt.name, pe.Line, pe.Column, pe.Offset, pe.Snippet, tt.line, tt.column, tt.offset, tt.snippet)
+		}
+		if want := fmt.Sprintf("line %d, column %d: ", tt.line, tt.column); !strings.Contains(err.Error(), want) {
+			t.Errorf("%s: error message %q doesn't contain %q", tt.name, err, want)
+		}
+	}
+}
+
+func TestErrorCodes(t *testing.T) {
+	for c := OK; c <= ErrCommentValue; c++ {
+		if name := c.String(); name == "" || strings.HasPrefix(name, "ErrorCode(") {
+			t.Errorf("ErrorCode %d has no name", int(c))
+		}
+	}
+	if got, want := ErrBadHTML.Error(), "htmlwriter: ErrBadHTML"; got != want {
+		t.Errorf("ErrBadHTML.Error() = %q, want %q", got, want)
+	}
+	for _, c := range []ErrorCode{-1, ErrCommentValue + 1} {
+		if got, want := c.String(), fmt.Sprintf("ErrorCode(%d)", int(c)); got != want {
+			t.Errorf("String() = %q, want %q", got, want)
+		}
+	}
+
+	e := New(io.Discard)
+	err := e.Literal(`<a href="x"<`)
+	wrapped := fmt.Errorf("rendering page: %w", err)
+	if !errors.Is(wrapped, ErrBadHTML) {
+		t.Errorf("errors.Is(%v, ErrBadHTML) = false", wrapped)
+	}
+	if errors.Is(wrapped, ErrAmbigContext) {
+		t.Errorf("errors.Is(%v, ErrAmbigContext) = true", wrapped)
+	}
+	var pe *Error
+	if !errors.As(wrapped, &pe) || pe.ErrorCode != ErrBadHTML || pe.Description == "" {
+		t.Errorf("errors.As(%v) = %+v", wrapped, pe)
+	}
+}
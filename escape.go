@@ -30,6 +30,8 @@ func contextAfterText(c context, s string) (context, int) {
 		return transitionFunc[c.state](c, s[:i])
 	}
 
+	// The delimiter is found before any entities are decoded, so an encoded
+	// quote, as in title="He said &quot;", does not end the attribute.
 	i := strings.IndexAny(s, delimEnds[c.delim])
 	if i == -1 {
 		i = len(s)
@@ -60,13 +62,17 @@ func contextAfterText(c context, s string) (context, int) {
 		}
 		return c, len(s)
 	}
+	element := c.element
+	if c.attr == attrScriptType && isJSONType(html.UnescapeString(s[:i])) {
+		element = elementJSONScript
+	}
 	if c.delim != delimSpaceOrTagEnd {
 		// Consume any quote.
 		i++
 	}
 	// On exiting an attribute, we discard all state information
 	// except the state and element.
-	return context{state: stateTag, element: c.element}, i
+	return context{state: stateTag, element: element}, i
 }
 
 // delimEnds maps each delim to a string of characters that terminate it.
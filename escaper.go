@@ -3,13 +3,213 @@
 // operates at run time rather than at the time of template compilation.
 package escaper
 
-import "io"
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"unicode/utf8"
+)
 
 // An Escaper wraps an io.Writer and provides automatic contextual escaping
 // for HTML output.
 type Escaper struct {
-	w   io.Writer
-	ctx context
+	// StrictErrors makes the Escaper panic when it is used after an
+	// escaping error, instead of returning the same error again. This
+	// helps to find the root cause of a cascade of errors during
+	// development.
+	StrictErrors bool
+
+	// ErrorPolicy selects what happens when a value can't be escaped, or
+	// literal HTML can't be parsed.
+	ErrorPolicy ErrorPolicy
+
+	// CommentValues selects what happens to values that are written inside
+	// a comment. By default they are dropped.
+	CommentValues CommentPolicy
+
+	// OnError, if it is not nil, is called with each escaping error, before
+	// ErrorPolicy is applied. This lets the errors be logged even when
+	// they don't stop the output.
+	OnError func(error)
+
+	// Nonce is a Content Security Policy nonce. If it is set, helper methods
+	// that write script elements give them a nonce attribute.
+	Nonce string
+
+	// AutoNonce makes Literal add a nonce attribute, with the value of
+	// Nonce, to every script and style start tag, right after the tag
+	// name. (If the tag already has a nonce attribute, browsers use the
+	// first one.)
+	AutoNonce bool
+
+	// ModulePreload makes Script write a <link rel="modulepreload"> for
+	// module scripts, so that the browser can start loading them sooner.
+	ModulePreload bool
+
+	// Warn, if it is not nil, is called to report problems that do not
+	// affect the safety of the output, but probably indicate a bug, such
+	// as a malformed language tag in a lang attribute.
+	Warn func(error)
+
+	// Debug enables DebugMarker.
+	Debug bool
+
+	// Trace, if it is not nil, is called each time the output moves the parser
+	// from one state to another, with the states before and after and the
+	// text that caused the transition. It is meant for finding out why a
+	// value was escaped the way it was; see TraceWriter.
+	Trace func(from, to ContextInfo, text string)
+
+	// PreferUnquoted makes Attr leave attribute values unquoted if they
+	// don't contain any characters that would require quoting.
+	PreferUnquoted bool
+
+	// RequireQuotedAttrs makes Value return an error, instead of quoting
+	// the value or escaping it for an unquoted attribute value, when it is
+	// written where an attribute value has been left unquoted in the
+	// literal HTML, as in <a href=/x/{{.}}> or <a href={{.}}>. Attr still
+	// works, since it writes the quotes itself.
+	RequireQuotedAttrs bool
+
+	// OmitEmptyAttrs makes Attr write nothing if the value is nil, a nil
+	// pointer, or something that is written as an empty string, instead of
+	// an attribute with an empty value.
+	OmitEmptyAttrs bool
+
+	// NormalizeVoidElements makes Literal rewrite the start tags of void
+	// elements, such as <br>, to match the XHTML setting.
+	NormalizeVoidElements bool
+
+	// XHTML selects XHTML syntax for void elements (<br/>) when they are
+	// normalized. Otherwise HTML syntax (<br>) is used.
+	XHTML bool
+
+	// XML makes the output well-formed XML, for XHTML documents, EPUB,
+	// and SVG documents. Void elements are normalized with XHTML syntax,
+	// Attr always quotes its value, and BoolAttr writes disabled="disabled"
+	// instead of disabled. In text and attribute values, Literal replaces
+	// named character references other than the five that XML predefines
+	// with numeric ones, and writes an '&' that doesn't start a reference
+	// as "&amp;"; quotes are written as "&quot;" and "&apos;". A
+	// character reference must not be split between two literals, or it
+	// will be left as it is. The literal HTML must otherwise be
+	// well-formed XML already: for example, its attribute values must be
+	// quoted.
+	XML bool
+
+	// StrictSVGUse restricts URLs in the href and xlink:href attributes of
+	// SVG <use> elements to references within the same document (#id).
+	// Values that would refer to an external document are replaced with
+	// "#ZgotmplZ".
+	StrictSVGUse bool
+
+	// MaxAttributes, if it is positive, is the number of attributes a tag
+	// is expected to have at most. Tags with more attributes, and values
+	// that write more than one attribute, are reported to Warn. This is a
+	// heuristic check for values that smuggle in extra attributes.
+	MaxAttributes int
+
+	// StrictURLEncoding makes values in URLs percent-encode the characters
+	// that RFC 3986 calls sub-delimiters (such as '!', '$', '*', '+', and
+	// ','), which are left alone by default. In the path, '&', ';' and '='
+	// are encoded too; in the query and fragment, they are left alone,
+	// since they separate parameters.
+	StrictURLEncoding bool
+
+	// URLPolicy, if it is not nil, replaces DefaultURLPolicy as the check
+	// for values that are written at the start of a URL: in a URL
+	// attribute, an image candidate in a srcset, or a CSS url(...). It
+	// returns the URL to write (which is normalized as usual), and whether
+	// the URL is allowed. A URL that is not allowed is replaced with
+	// "#ZgotmplZ". Values that are written after the start of a URL, as in
+	// href="/users/{{.}}", are not checked.
+	URLPolicy func(url string, ctx URLContext) (string, bool)
+
+	// URLSchemes lists URL schemes (such as "tel" or "web+app") that are
+	// allowed in addition to the ones that DefaultURLPolicy allows. It
+	// doesn't apply if URLPolicy is set.
+	URLSchemes []string
+
+	// DataURLTypes lists the media types (such as "image/png") that are
+	// allowed in data: URLs. A type of "image/*" allows all image types
+	// except image/svg+xml, and "*" allows all data: URLs. SVG images must
+	// be listed by name, since they are allowed in every URL attribute, and
+	// an SVG document loaded by an iframe, object, or embed element can run
+	// scripts. By default, data: URLs are not allowed. It doesn't apply if
+	// URLPolicy is set.
+	DataURLTypes []string
+
+	// Indent, if it is not empty, turns on pretty-printing: Literal puts
+	// the tags of block elements on lines of their own, indented with
+	// Indent once for each enclosing block element. White space is only
+	// added next to block elements, and the content of pre elements is
+	// left unchanged.
+	Indent string
+
+	// BlockElements is the set of (lowercase) element names that are
+	// treated as block elements for pretty-printing. If it is nil,
+	// DefaultBlockElements is used.
+	BlockElements map[string]bool
+
+	// CheckTagBalance makes the Escaper keep track of which elements are
+	// open, so that Finish can report elements that were not closed.
+	CheckTagBalance bool
+
+	// AllowedTags, if it is not nil, turns Literal into a sanitizer for
+	// HTML that is only partly trusted. This is sanitization, not escaping:
+	// instead of just keeping track of the context, Literal drops tags
+	// whose (lowercase) names are not in AllowedTags, along with comments,
+	// CDATA sections, and the content of elements such as script and
+	// style. In the tags that are allowed, event handler, style, and srcdoc
+	// attributes are dropped, and URLs that are rejected by URLPolicy (or
+	// DefaultURLPolicy) are replaced with "#ZgotmplZ".
+	// Elements whose content browsers parse as raw text, such as noscript,
+	// iframe, and xmp, are never allowed.
+	// Tag and attribute names must each be written in a single literal.
+	// Values are escaped as usual.
+	AllowedTags map[string]bool
+
+	// StripComments makes Literal drop HTML comments, instead of writing
+	// them, so that notes meant for the authors of a page are not sent to
+	// browsers. Values in a comment are dropped along with it, and so are
+	// conditional comments. A comment is kept if its "<!--" is split
+	// between two literals, and comments in scripts and style sheets are
+	// left alone.
+	StripComments bool
+
+	w      io.Writer
+	ctx    context
+	tag    tagInfo
+	pretty prettyState
+	san    sanitizeState
+	// stripping is true while a comment is being dropped because of
+	// StripComments.
+	stripping bool
+	filter    func([]byte) []byte
+
+	// failsafe replaces filterFailsafe if customFailsafe is set.
+	failsafe       string
+	customFailsafe bool
+
+	// borrowed is true while the string being processed shares its memory
+	// with a byte slice passed to LiteralBytes or ValueBytes.
+	borrowed bool
+
+	// open is the stack of open elements, and unclosed lists elements that
+	// were closed implicitly but need end tags, when CheckTagBalance is set.
+	open     []string
+	unclosed []string
+
+	// pos is the number of bytes that have been passed to literal, line
+	// is the number of newlines in them, and lineStart is the offset of
+	// the start of the current line.
+	pos       int64
+	line      int
+	lineStart int64
 }
 
 // New returns a new Escaper that wraps w.
@@ -19,86 +219,353 @@ func New(w io.Writer) *Escaper {
 	}
 }
 
+// Reset makes e write to w, starting over in the HTML text context, as if it
+// were new. Its options, output filter, and failsafe string are kept. This
+// lets Escapers be reused, for example with a sync.Pool.
+func (e *Escaper) Reset(w io.Writer) {
+	e.w = w
+	e.ctx = context{}
+	e.tag = tagInfo{}
+	e.pretty = prettyState{}
+	e.san = sanitizeState{}
+	e.stripping = false
+	e.open = e.open[:0]
+	e.unclosed = e.unclosed[:0]
+	e.pos, e.line, e.lineStart = 0, 0, 0
+}
+
 // Literal writes a string of literal HTML.
 func (e *Escaper) Literal(s string) error {
+	return e.literal(s)
+}
+
+// literal implements Literal. It is also used for the output of Value, which
+// has already been escaped.
+func (e *Escaper) literal(s string) error {
+	if err := e.stickyError(); err != nil {
+		return err
+	}
+
+	// If the output needs to be different from s, out holds the output for
+	// s[:written].
+	var out []byte
+	written := 0
+
+	e.tag.slashAt = -1
 	i := 0
+	errAt := -1
 	for i < len(s) {
+		c0 := e.ctx
+		var from ContextInfo
+		if e.Trace != nil {
+			from = e.Context()
+		}
 		var n int
 		e.ctx, n = contextAfterText(e.ctx, s[i:])
+		if e.ctx.err != nil && errAt == -1 {
+			errAt = i
+		}
+		tagEnd := e.trackTag(c0, s[i:i+n], i)
+		if e.StripComments {
+			var dropped bool
+			out, written, dropped = e.stripComment(c0, out, s, written, i, n)
+			if dropped {
+				i += n
+				continue
+			}
+		}
+		if e.Trace != nil {
+			if to := e.Context(); to != from {
+				text := s[i : i+n]
+				if e.borrowed {
+					// The tracer may keep the text, so it must
+					// not share memory with the caller's byte
+					// slice.
+					text = string([]byte(text))
+				}
+				e.Trace(from, to, text)
+			}
+		}
+		if e.AllowedTags != nil {
+			var dropped bool
+			out, written, dropped = e.sanitize(c0, out, s, written, i, n)
+			if dropped {
+				i += n
+				continue
+			}
+		}
+		if e.XML {
+			out, written = e.xmlEntities(c0, out, s, written, i, n)
+		}
+		if tagEnd && (e.NormalizeVoidElements || e.XML) {
+			out, written = e.normalizeVoid(out, s, written, i+n-1)
+		}
+		if e.Indent != "" {
+			out, written = e.prettyPrint(c0, tagEnd, out, s, written, i, n)
+		}
+		if e.AutoNonce && e.Nonce != "" {
+			out, written = e.addNonce(c0, out, s, written, i+n)
+		}
 		i += n
 	}
 	if e.ctx.err != nil {
-		return e.ctx.err
+		if errAt == -1 {
+			// The error came from a context passed to
+			// RestoreContext.
+			errAt = 0
+		}
+		e.setPosition(e.ctx.err, s, errAt)
+		return e.handleError(e.ctx.err)
 	}
+	e.advance(s)
 
-	_, err := io.WriteString(e.w, s)
+	if out != nil || written > 0 {
+		_, err := e.Write(append(out, s[written:]...))
+		return err
+	}
+	_, err := e.writeString(s)
 	return err
 }
 
 // Value escapes v as appropriate for the current context, and writes the
 // result.
+//
+// If v is a List, each of its elements is escaped and written as a value in
+// HTML text. In other contexts, the elements are joined into a single string,
+// which is escaped as one value, so that a URL, for example, is checked as a
+// whole.
+//
+// Values of the content types from html/template are trusted in the contexts
+// they are meant for, as they are in templates. For example, in a script, a
+// template.JS value such as `{"a":1}` is written verbatim, while the string
+// `{"a":1}` is written as a quoted JavaScript string.
+//
+// Tag names should come from literal markup, not from values. A value written
+// where a tag name is expected (right after "<" or "</") is replaced with
+// "ZgotmplZ", unless it is written after "<" and can't start a tag, as in
+// "1 <2"; then it is escaped as text.
 func (e *Escaper) Value(v interface{}) error {
+	failsafe, err := e.checkQuoted()
+	if err != nil {
+		return err
+	}
+	if failsafe {
+		v = e.failsafeFor(filterFailsafe)
+	}
+	return e.value(v, false)
+}
+
+// checkQuoted reports an error if e.RequireQuotedAttrs is set and e is at the
+// start of an attribute value or in an unquoted one. The error is handled
+// like an error in escaping a value: under WriteFailsafe, it is passed to
+// OnError, and checkQuoted returns true, to write the failsafe string instead
+// of the value.
+func (e *Escaper) checkQuoted() (failsafe bool, err error) {
+	if !e.RequireQuotedAttrs || e.ctx.state == stateError {
+		return false, nil
+	}
+	if e.ctx.state != stateBeforeValue && e.ctx.delim != delimSpaceOrTagEnd {
+		return false, nil
+	}
+	qerr := errorf(ErrBadHTML, "value in unquoted attribute value in <%s>", e.tag.name)
+	if e.ErrorPolicy != WriteFailsafe {
+		e.ctx = context{state: stateError, err: qerr}
+		e.setPosition(qerr, "", 0)
+		return false, e.handleError(qerr)
+	}
+	if e.OnError != nil {
+		e.OnError(qerr)
+	}
+	return true, nil
+}
+
+// value implements Value. If unquoted is true, a value at the start of an
+// attribute value is written without quotes if it doesn't need them.
+func (e *Escaper) value(v interface{}, unquoted bool) error {
+	if err := e.stickyError(); err != nil {
+		return err
+	}
+
+	switch v := v.(type) {
+	case *Escaper:
+		return errorf(ErrBadArg, "an *Escaper cannot be written as a value")
+	case List:
+		if e.ctx.state != stateText {
+			// Filters such as the one for URL schemes need to see
+			// the whole value.
+			return e.value(joinList(v), unquoted)
+		}
+		for _, elem := range v {
+			if err := e.value(elem, false); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if e.ctx.attr == attrLang && e.Warn != nil {
+		if tag, _ := stringify(v); !isLangTag(tag) {
+			e.Warn(errorf(ErrBadValue, "%q is not a valid language tag", tag))
+		}
+	}
+
+	if e.StrictSVGUse && e.tag.name == "use" && (e.ctx.state == stateBeforeValue && e.ctx.attr == attrURL || e.ctx.state == stateURL && e.ctx.urlPart == urlPartNone) {
+		v = fragmentFilter(v)
+	}
+
 	if e.ctx.state == stateBeforeValue {
+		if unquoted {
+			quoted, _ := contextAfterText(e.ctx, `"`)
+			if _, s, err := e.escapeValue(quoted, v); err == nil && isUnquotedSafe(s) {
+				return e.Literal(s)
+			}
+		}
 		// Automatically double-quote attribute values.
 		e.Literal(`"`)
 		defer e.Literal(`"`)
 	}
 
-	e.ctx = nudge(e.ctx)
+	c, s, err := e.escapeValue(e.ctx, v)
+	if err != nil {
+		if e.ErrorPolicy != WriteFailsafe {
+			e.ctx = c
+			e.setPosition(err, "", 0)
+			return e.handleError(err)
+		}
+		if e.OnError != nil {
+			e.OnError(err)
+		}
+		c, s = nudge(e.ctx), e.failsafeFor(filterFailsafe)
+	}
+	if e.tag.dropsNewline && strings.HasPrefix(s, "\n") {
+		// The parser will drop the first newline, so add another one to
+		// keep the one that is part of the value.
+		s = "\n" + s
+	}
+	attrs := e.tag.attrs
+	if e.ctx.state == stateTag && c.state == stateAttrName {
+		// The value starts an attribute name.
+		e.countAttr()
+	}
+	e.ctx = c
+	err = e.literal(s)
+	if n := e.tag.attrs - attrs; n > 1 && e.MaxAttributes > 0 && e.Warn != nil {
+		e.Warn(errorf(ErrAttrCount, "value %.32q expands into %d attributes", s, n))
+	}
+	return err
+}
+
+// escapeValue escapes v for context c, according to e's settings. It returns
+// the context to continue
+// from (before the escaped value is processed as literal text), and the
+// escaped value.
+func (e *Escaper) escapeValue(c context, v interface{}) (context, string, error) {
+	c = nudge(c)
 	s := make([]func(...interface{}) string, 0, 3)
-	switch e.ctx.state {
+	// filtered is set if s[0] is a filter that may reject the value.
+	filtered := false
+	switch c.state {
 	case stateError:
-		return e.ctx.err
+		return c, "", c.err
 	case stateURL, stateCSSDqStr, stateCSSSqStr, stateCSSDqURL, stateCSSSqURL, stateCSSURL:
-		switch e.ctx.urlPart {
+		switch c.urlPart {
 		case urlPartNone:
-			s = append(s, urlFilter)
+			s = append(s, e.urlFilter(c))
+			filtered = true
 			fallthrough
 		case urlPartPreQuery:
-			switch e.ctx.state {
-			case stateCSSDqStr, stateCSSSqStr:
+			switch {
+			case c.state == stateCSSDqStr, c.state == stateCSSSqStr:
 				s = append(s, cssEscaper)
+			case e.StrictURLEncoding:
+				// The URL filter passes a plain string along, so
+				// check for a trusted URL here.
+				if _, ok := indirect(toTrusted(v)).(template.URL); ok {
+					s = append(s, urlNormalizer)
+				} else {
+					s = append(s, urlStrictNormalizer)
+				}
 			default:
 				s = append(s, urlNormalizer)
 			}
 		case urlPartQueryOrFrag:
 			s = append(s, urlEscaper)
 		case urlPartUnknown:
-			e.ctx = context{
+			c = context{
 				state: stateError,
 				err:   errorf(ErrAmbigContext, "tried to print %v in an ambiguous URL context", v),
 			}
-			return e.ctx.err
+			return c, "", c.err
 		default:
-			panic(e.ctx.urlPart.String())
+			panic(c.urlPart.String())
 		}
+	case stateSrcset:
+		s = append(s, e.srcsetFilter())
+		filtered = true
 	case stateJS:
-		s = append(s, jsValEscaper)
 		// A slash after a value starts a div operator.
-		e.ctx.jsCtx = jsCtxDivOp
+		c.jsCtx = jsCtxDivOp
+		if c.element == elementJSONScript {
+			// A JSON script can't hold a comment to explain an
+			// encoding error, so report it instead.
+			if t, ok := toTrusted(v).(template.JS); ok {
+				return c, string(t), nil
+			}
+			js, err := jsonScriptEscaper(v)
+			return c, js, err
+		}
+		s = append(s, jsValEscaper)
 	case stateJSDqStr, stateJSSqStr:
+		if c.element == elementJSONScript && c.state == stateJSDqStr {
+			s = append(s, jsonStrEscaper)
+			break
+		}
 		s = append(s, jsStrEscaper)
 	case stateJSRegexp:
 		s = append(s, jsRegexpEscaper)
 	case stateCSS:
 		s = append(s, cssValueFilter)
+		filtered = true
 	case stateText:
 		s = append(s, htmlEscaper)
 	case stateRCDATA:
 		s = append(s, rcdataEscaper)
+	case stateCDATA:
+		s = append(s, cdataEscaper)
 	case stateAttr:
 		// Handled below in delim check.
 	case stateAttrName, stateTag:
-		e.ctx.state = stateAttrName
+		c.state = stateAttrName
 		s = append(s, htmlNameFilter)
+		filtered = true
+	case stateTagOpen:
+		if t := htmlEscaper(v); !canStartTag(t) {
+			if t == "" {
+				return c, "", nil
+			}
+			// The "<" is just text, as in "1 <2".
+			return context{}, t, nil
+		}
+		s = append(s, tagNameFilter)
+		filtered = true
+	case stateEndTagOpen:
+		s = append(s, tagNameFilter)
+		filtered = true
 	default:
-		if isComment(e.ctx.state) {
-			s = append(s, commentEscaper)
+		if isComment(c.state) {
+			switch {
+			case e.CommentValues == RejectCommentValues:
+				return c, "", errorf(ErrCommentValue, "value in %v", c.state)
+			case e.CommentValues == EscapeCommentValues && (c.state == stateHTMLCmt || c.state == stateBogusCmt):
+				s = append(s, htmlEscaper)
+			default:
+				s = append(s, commentEscaper)
+			}
 		} else {
-			panic("unexpected state " + e.ctx.state.String())
+			panic("unexpected state " + c.state.String())
 		}
 	}
-	switch e.ctx.delim {
+	switch c.delim {
 	case delimNone:
 		// No extra-escaping needed for raw text content.
 	case delimSpaceOrTagEnd:
@@ -107,14 +574,231 @@ func (e *Escaper) Value(v interface{}) error {
 		s = append(s, attrEscaper)
 	}
 
-	for _, filter := range s {
+	for i, filter := range s {
 		v = filter(v)
+		if i == 0 && filtered && e.customFailsafe {
+			v = e.replaceFailsafe(v.(string), c.state == stateSrcset)
+		}
 	}
 	if len(s) == 0 {
 		v, _ = stringify(v)
 	}
+	return c, v.(string), nil
+}
+
+// urlFilter returns the filter for a value at the start of a URL in context c.
+func (e *Escaper) urlFilter(c context) func(...interface{}) string {
+	policy := e.urlPolicy()
+	if policy == nil {
+		return urlFilter
+	}
+	return func(args ...interface{}) string {
+		s, t := stringify(args...)
+		ctx := URLContext{
+			Element: e.tag.name,
+			Attr:    e.tag.attr,
+			CSS:     c.state != stateURL,
+			Trusted: t == contentTypeURL,
+		}
+		if c.delim == delimNone {
+			// In a style element.
+			ctx.Attr = ""
+		}
+		if u, ok := policy(s, ctx); ok {
+			return u
+		}
+		return "#" + filterFailsafe
+	}
+}
+
+// srcsetFilter returns the filter for a value in a srcset attribute.
+func (e *Escaper) srcsetFilter() func(...interface{}) string {
+	policy := e.urlPolicy()
+	if policy == nil {
+		return srcsetFilterAndEscaper
+	}
+	ctx := URLContext{Element: e.tag.name, Attr: e.tag.attr, Srcset: true}
+	check := func(url string, trusted bool) (string, bool) {
+		ctx.Trusted = trusted
+		return policy(url, ctx)
+	}
+	return func(args ...interface{}) string {
+		return filterSrcset(check, args...)
+	}
+}
+
+// urlPolicy returns the URL policy that e uses, or nil if it uses
+// DefaultURLPolicy, which is built into urlFilter and srcsetFilterAndEscaper.
+func (e *Escaper) urlPolicy() func(string, URLContext) (string, bool) {
+	switch {
+	case e.URLPolicy != nil:
+		return e.URLPolicy
+	case len(e.URLSchemes) > 0, len(e.DataURLTypes) > 0:
+		return e.schemePolicy
+	}
+	return nil
+}
+
+// schemePolicy is DefaultURLPolicy, extended with e.URLSchemes and
+// e.DataURLTypes.
+func (e *Escaper) schemePolicy(url string, ctx URLContext) (string, bool) {
+	if u, ok := DefaultURLPolicy(url, ctx); ok {
+		return u, true
+	}
+	scheme := urlScheme(url)
+	if scheme == "data" {
+		return url, isAllowedDataURL(url, e.DataURLTypes)
+	}
+	for _, s := range e.URLSchemes {
+		if strings.EqualFold(s, scheme) {
+			return url, true
+		}
+	}
+	return url, false
+}
 
-	return e.Literal(v.(string))
+// AppendEscaped appends src, escaped for the context described by ci, to dst
+// and returns the extended buffer. The result is the same as what Value
+// would write in that context for string(src), including the quotes added
+// at the start of an attribute value. It does not write anything to an
+// Escaper, so ci does not change; callers that keep writing after the value
+// are responsible for tracking the context themselves, for example with
+// LiteralDelta.
+func AppendEscaped(dst []byte, ci ContextInfo, src []byte) ([]byte, error) {
+	c := ci.c
+	quoted := c.state == stateBeforeValue
+	if quoted {
+		c, _ = contextAfterText(c, `"`)
+	}
+	// Use the default settings.
+	var e Escaper
+	_, s, err := e.escapeValue(c, string(src))
+	if err != nil {
+		return dst, err
+	}
+	if quoted {
+		dst = append(dst, '"')
+		dst = append(dst, s...)
+		return append(dst, '"'), nil
+	}
+	return append(dst, s...), nil
+}
+
+// Context returns the current state of e's HTML parser.
+func (e *Escaper) Context() ContextInfo {
+	tag := e.tag
+	// slashAt is only meaningful during a call to Literal.
+	tag.slashAt = -1
+	return ContextInfo{e.ctx, tag}
+}
+
+// SaveContext returns the current state of e's HTML parser, so that it can
+// be restored later with RestoreContext. This lets a renderer backtrack
+// after writing a speculative branch of output to a buffer of its own.
+func (e *Escaper) SaveContext() ContextInfo {
+	return e.Context()
+}
+
+// RestoreContext sets the state of e's HTML parser to ci, which was returned
+// by SaveContext. Output that has already been written is not affected.
+//
+// Restoring a context that was saved before an error clears the error. But
+// since output that was written before the error stays in place, a
+// speculative fragment should be rendered by a separate Escaper that writes
+// to a buffer and starts in e's context, and only copied to e if it succeeds
+// (Capture does the same):
+//
+//	var buf bytes.Buffer
+//	w := escaper.New(&buf)
+//	w.RestoreContext(e.SaveContext())
+//	if err := renderWidget(w); err == nil {
+//		e.LiteralBytes(buf.Bytes())
+//	} else {
+//		e.Literal("<p>Widget unavailable.</p>")
+//	}
+//
+// Only the parser context is saved; the state used by options such as
+// CheckTagBalance and Indent is not rewound.
+func (e *Escaper) RestoreContext(ci ContextInfo) {
+	e.ctx, e.tag = ci.c, ci.tag
+}
+
+// LiteralDelta is like Literal, but it also returns the parser context before
+// and after s. This lets a caller memoize the effect that a piece of markup
+// has on the context.
+func (e *Escaper) LiteralDelta(s string) (before, after ContextInfo, err error) {
+	before = e.Context()
+	err = e.Literal(s)
+	return before, e.Context(), err
+}
+
+// advance updates e's position after s has been passed to literal.
+func (e *Escaper) advance(s string) {
+	if n := strings.Count(s, "\n"); n > 0 {
+		e.line += n
+		e.lineStart = e.pos + int64(strings.LastIndexByte(s, '\n')) + 1
+	}
+	e.pos += int64(len(s))
+}
+
+// setPosition sets the position of err, if it is an *Error without one, to
+// s[i:], where s is being passed to literal.
+func (e *Escaper) setPosition(err error, s string, i int) {
+	pe, ok := err.(*Error)
+	if !ok || pe.Line != 0 {
+		return
+	}
+	pe.Offset = e.pos + int64(i)
+	pe.Line = e.line + 1
+	lineStart := e.lineStart
+	if nl := strings.LastIndexByte(s[:i], '\n'); nl != -1 {
+		pe.Line += strings.Count(s[:i], "\n")
+		lineStart = e.pos + int64(nl) + 1
+	}
+	pe.Column = int(pe.Offset-lineStart) + 1
+
+	// Show up to 16 bytes before the error and 32 after it, without
+	// splitting runes.
+	start, end := i-16, i+32
+	if start < 0 {
+		start = 0
+	}
+	if end > len(s) {
+		end = len(s)
+	}
+	for start < i && !utf8.RuneStart(s[start]) {
+		start++
+	}
+	for end < len(s) && !utf8.RuneStart(s[end]) {
+		end--
+	}
+	pe.Snippet = s[start:end]
+	if e.borrowed {
+		pe.Snippet = string([]byte(pe.Snippet))
+	}
+}
+
+// handleError applies e.OnError and e.ErrorPolicy to err, which has just
+// occurred, and returns it.
+func (e *Escaper) handleError(err error) error {
+	if e.OnError != nil {
+		e.OnError(err)
+	}
+	if e.ErrorPolicy == PanicOnError {
+		panic(err)
+	}
+	return err
+}
+
+// stickyError returns the error that put e into the error state, if any.
+func (e *Escaper) stickyError() error {
+	if e.ctx.state != stateError {
+		return nil
+	}
+	if e.StrictErrors {
+		panic(fmt.Sprintf("escaper: used after error: %v", e.ctx.err))
+	}
+	return e.ctx.err
 }
 
 // Print writes some HTML. It interprets its arguments as an alternating list
@@ -156,13 +840,377 @@ func (e *Escaper) Print(args ...interface{}) error {
 	return nil
 }
 
+// Printf writes format as literal HTML, with each verb replaced by the
+// corresponding argument, escaped according to the context where it appears.
+// The verbs %v and %s write their argument just as Value would, so the content
+// types from html/template are trusted in the contexts they are meant for.
+// Other verbs, such as %d or %.2f, format their argument with fmt.Sprintf
+// first, and the result is escaped as a string. %% writes a percent sign.
+//
+// Unlike fmt.Printf, Printf returns an ErrBadArg error, without writing
+// anything, if the number of arguments doesn't match the number of verbs, or
+// if the format uses explicit argument indexes (%[1]s), a '*' for the width
+// or precision, or a verb that fmt doesn't have.
+func (e *Escaper) Printf(format string, args ...interface{}) error {
+	verbs := 0
+	for rest := format; ; {
+		i, j, err := nextVerb(rest)
+		if err != nil {
+			return err
+		}
+		if i == -1 {
+			break
+		}
+		if rest[j-1] != '%' {
+			verbs++
+		}
+		rest = rest[j:]
+	}
+	if verbs != len(args) {
+		return errorf(ErrBadArg, "%d arguments were passed, but format has %d verbs", len(args), verbs)
+	}
+
+	argNum := 0
+	for {
+		i, j, _ := nextVerb(format)
+		if i == -1 {
+			break
+		}
+		if err := e.Literal(format[:i]); err != nil {
+			return err
+		}
+		verb := format[i:j]
+		format = format[j:]
+		if verb[len(verb)-1] == '%' {
+			if err := e.Literal("%"); err != nil {
+				return err
+			}
+			continue
+		}
+		arg := args[argNum]
+		argNum++
+		if verb != "%v" && verb != "%s" {
+			arg = fmt.Sprintf(verb, arg)
+		}
+		if err := e.Value(arg); err != nil {
+			return err
+		}
+	}
+	return e.Literal(format)
+}
+
+// printfVerbs is the set of verbs that fmt supports.
+const printfVerbs = "%vTtbcdoOqxXUeEfFgGsp"
+
+// nextVerb finds the first verb in format, and returns the indexes of its '%'
+// and of the byte after it. If there are no more verbs, it returns -1 for i.
+func nextVerb(format string) (i, j int, err error) {
+	i = strings.IndexByte(format, '%')
+	if i == -1 {
+		return -1, 0, nil
+	}
+	j = i + 1
+	for j < len(format) && strings.IndexByte("+-# 0123456789.", format[j]) != -1 {
+		j++
+	}
+	switch {
+	case j == len(format):
+		return 0, 0, errorf(ErrBadArg, "incomplete verb at end of format %q", format)
+	case format[j] == '[':
+		return 0, 0, errorf(ErrBadArg, "explicit argument indexes are not supported: %q", format)
+	case format[j] == '*':
+		return 0, 0, errorf(ErrBadArg, "'*' for width or precision is not supported: %q", format)
+	case strings.IndexByte(printfVerbs, format[j]) == -1:
+		return 0, 0, errorf(ErrBadArg, "unknown verb %q in format %q", format[i:j+1], format)
+	}
+	return i, j + 1, nil
+}
+
+// A Formatted is a value that is formatted with a fmt verb, such as "%.2f",
+// when it is written with Value. It is created by Format.
+type Formatted struct {
+	verb string
+	v    interface{}
+}
+
+// Format returns a Formatted value, which is written by Value as v formatted
+// with verb, instead of with fmt.Sprint. For example,
+//
+//	e.Value(escaper.Format("%.2f", price))
+//
+// writes the price with two decimal places. In JavaScript code, a formatted
+// number is written as a number, not a string. Values that implement
+// fmt.Formatter can use verb to control their formatting.
+func Format(verb string, v interface{}) Formatted {
+	return Formatted{verb, v}
+}
+
+// String returns the formatted value.
+func (f Formatted) String() string {
+	return fmt.Sprintf(f.verb, f.v)
+}
+
+// MarshalJSON encodes the formatted value as a JSON number if the original
+// value is a number and the formatted value is a valid JSON number, and as a
+// string otherwise.
+func (f Formatted) MarshalJSON() ([]byte, error) {
+	s := f.String()
+	switch reflect.ValueOf(indirect(f.v)).Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64:
+		var n json.Number
+		if strings.TrimSpace(s) == s && json.Unmarshal([]byte(s), &n) == nil {
+			return []byte(s), nil
+		}
+	}
+	return json.Marshal(s)
+}
+
+// PrintChan writes HTML fragments from ch, in order, until ch is closed. The
+// fragments are trusted, so they are written as literal HTML (with context
+// tracking), just as if they had been passed to Literal. If writing a fragment
+// causes an error, PrintChan returns it without receiving any more fragments
+// from ch.
+func (e *Escaper) PrintChan(ch <-chan template.HTML) error {
+	for frag := range ch {
+		if err := e.Literal(string(frag)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ExecuteTemplate executes t with data, and writes its output, which t has
+// already escaped, as literal HTML (with context tracking). Since
+// html/template escapes its output for a template that starts in HTML text,
+// ExecuteTemplate must be called in HTML text.
+func (e *Escaper) ExecuteTemplate(t *template.Template, data interface{}) error {
+	if err := e.requireText("ExecuteTemplate"); err != nil {
+		return err
+	}
+	return t.Execute(literalWriter{e}, data)
+}
+
+// A literalWriter writes its input to an Escaper as literal HTML.
+type literalWriter struct {
+	e *Escaper
+}
+
+func (w literalWriter) Write(p []byte) (n int, err error) {
+	if err := w.e.LiteralBytes(p); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// ValueFrom escapes the data read from r until EOF, as if it had been passed
+// to Value as a string. In contexts where each part of a value can be escaped
+// separately (HTML text and attribute values, RCDATA, comments, JavaScript
+// strings, and URL queries), the data is escaped as it is read, without
+// holding all of it in memory. In JavaScript code outside of attributes, it is
+// written as a string literal in the same way. In other contexts, such as at
+// the start of a URL, the whole value needs to be checked at once, so it is
+// read completely and passed to Value.
+func (e *Escaper) ValueFrom(r io.Reader) error {
+	if err := e.stickyError(); err != nil {
+		return err
+	}
+	if failsafe, err := e.checkQuoted(); err != nil {
+		return err
+	} else if failsafe {
+		return e.value(e.failsafeFor(filterFailsafe), false)
+	}
+	c := e.ctx
+	if c.state == stateBeforeValue {
+		// The value will be quoted.
+		c, _ = contextAfterText(c, `"`)
+	}
+	c = nudge(c)
+	if !isStreamable(c) || e.ctx.attr == attrLang {
+		b, err := ioutil.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		return e.Value(string(b))
+	}
+	if e.ctx.state == stateBeforeValue || c.state == stateJS {
+		if err := e.Literal(`"`); err != nil {
+			return err
+		}
+		defer e.Literal(`"`)
+	}
+
+	buf := make([]byte, 8192)
+	n := 0
+	for {
+		m, err := r.Read(buf[n:])
+		n += m
+		k := n
+		if err == nil {
+			// Hold back an incomplete UTF-8 sequence until the rest of
+			// it is read.
+			k = completeRunes(buf[:n])
+		}
+		if k > 0 {
+			if err := e.Value(string(buf[:k])); err != nil {
+				return err
+			}
+			n = copy(buf, buf[k:n])
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// isStreamable reports whether a value in context c can be escaped in pieces
+// by ValueFrom.
+func isStreamable(c context) bool {
+	switch c.state {
+	case stateText, stateRCDATA, stateCDATA, stateAttr, stateJSDqStr, stateJSSqStr:
+		return true
+	case stateJS:
+		// The value is written as a string literal, whose quotes would
+		// end a quoted attribute.
+		return c.delim == delimNone
+	case stateURL, stateCSSDqStr, stateCSSSqStr, stateCSSDqURL, stateCSSSqURL, stateCSSURL:
+		return c.urlPart == urlPartQueryOrFrag
+	}
+	return isComment(c.state)
+}
+
+// completeRunes returns the length of the longest prefix of b that doesn't end
+// with an incomplete UTF-8 sequence.
+func completeRunes(b []byte) int {
+	for i := len(b) - 1; i >= 0 && i >= len(b)-utf8.UTFMax; i-- {
+		if utf8.RuneStart(b[i]) {
+			if utf8.FullRune(b[i:]) {
+				return len(b)
+			}
+			return i
+		}
+	}
+	return len(b)
+}
+
+// Finish checks that the output written so far is complete. It returns an
+// error if the output ends in a context other than HTML text, such as inside
+// a tag or a script. If e.CheckTagBalance is set, it also reports elements
+// that were not closed. Elements whose end tags are optional, such as li and
+// p, don't need to be closed.
+func (e *Escaper) Finish() error {
+	if err := e.stickyError(); err != nil {
+		return err
+	}
+	if e.ctx.state != stateText {
+		return errorf(ErrEndContext, "output ends in a non-text context: %v", e.ctx)
+	}
+	if e.CheckTagBalance {
+		if unclosed := e.unclosedElements(); len(unclosed) > 0 {
+			return errorf(ErrUnclosed, "unclosed elements: %s", strings.Join(unclosed, ", "))
+		}
+	}
+	return nil
+}
+
 // A List is a prepared argument list for Escaper.Print. It can be nested
 // within another call to Print.
 type List []interface{}
 
+// joinList concatenates the string forms of the elements of l, and of any
+// Lists nested in it.
+func joinList(l List) string {
+	var b strings.Builder
+	for _, elem := range l {
+		if sub, ok := elem.(List); ok {
+			b.WriteString(joinList(sub))
+			continue
+		}
+		s, _ := stringify(elem)
+		b.WriteString(s)
+	}
+	return b.String()
+}
+
+// Flush flushes the underlying Writer, if it has a Flush method, such as a
+// bufio.Writer or the Writer of an Escaper from ForHTTP.
+func (e *Escaper) Flush() error {
+	switch f := e.w.(type) {
+	case interface{ Flush() error }:
+		return f.Flush()
+	case interface{ Flush() }:
+		f.Flush()
+	}
+	return nil
+}
+
 // Write bypasses the escaper, and writes directly to the underlying Writer.
 // This is useful if part of your page is rendered with templates, or some
 // other library that expects a Writer.
 func (e *Escaper) Write(p []byte) (n int, err error) {
-	return e.w.Write(p)
+	if e.filter == nil {
+		return e.w.Write(p)
+	}
+	if _, err := e.w.Write(e.filter(p)); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// writeString writes s to the underlying Writer, passing it through the
+// output filter if there is one.
+func (e *Escaper) writeString(s string) (n int, err error) {
+	if e.filter == nil {
+		return io.WriteString(e.w, s)
+	}
+	return e.Write([]byte(s))
+}
+
+// SetFailsafe sets the string that is written in place of a value that is
+// rejected by a filter (such as a javascript: URL, or a value where a tag name
+// should be), instead of "ZgotmplZ", or "#ZgotmplZ" in a URL. It replaces
+// the rejected value before the value's context-specific escaping, but it is
+// not filtered, so it should be something that is harmless wherever it may be
+// written, such as an empty string or a plain word.
+func (e *Escaper) SetFailsafe(s string) {
+	e.failsafe, e.customFailsafe = s, true
+}
+
+// failsafeFor returns what to write in place of a rejected value, whose
+// replacement would be def by default.
+func (e *Escaper) failsafeFor(def string) string {
+	if e.customFailsafe {
+		return e.failsafe
+	}
+	return def
+}
+
+// replaceFailsafe replaces the default failsafe output of a filter in v with
+// e's failsafe string. If srcset is true, v is a srcset, and each rejected
+// image candidate is replaced.
+func (e *Escaper) replaceFailsafe(v string, srcset bool) string {
+	switch {
+	case v == filterFailsafe, v == "#"+filterFailsafe:
+		return e.failsafe
+	case srcset:
+		return strings.Replace(v, "#"+filterFailsafe, e.failsafe, -1)
+	}
+	return v
+}
+
+// SetOutputFilter sets a function that transforms all output (from Literal,
+// Value, Print, and Write) just before it is written to the underlying
+// Writer. Passing nil removes the filter.
+//
+// The filter is called once for each write, with whatever piece of output
+// is being written; it needs to handle strings that are split across calls.
+// It runs after escaping, so it is responsible for keeping its output safe.
+// Setting a filter adds a copy of each piece of output, and the cost of
+// the filter itself, to every write.
+func (e *Escaper) SetOutputFilter(f func([]byte) []byte) {
+	e.filter = f
 }
@@ -0,0 +1,700 @@
+package escaper
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+// valueTest is a test case that writes a value between two pieces of literal
+// HTML.
+type valueTest struct {
+	name          string
+	before, after string
+	value         interface{}
+	want          string
+}
+
+// runValueTests runs tests with Escapers that are configured by setup (if it
+// is not nil).
+func runValueTests(t *testing.T, setup func(e *Escaper), tests []valueTest) {
+	t.Helper()
+	for _, tt := range tests {
+		var b strings.Builder
+		e := New(&b)
+		if setup != nil {
+			setup(e)
+		}
+		err := e.Literal(tt.before)
+		if err == nil {
+			err = e.Value(tt.value)
+		}
+		if err == nil {
+			err = e.Literal(tt.after)
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if got := b.String(); got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+// render writes args to a new Escaper with Print, after calling setup (if it
+// is not nil) to configure it, and returns the output.
+func render(setup func(e *Escaper), args ...interface{}) (string, error) {
+	var b strings.Builder
+	e := New(&b)
+	if setup != nil {
+		setup(e)
+	}
+	err := e.Print(args...)
+	return b.String(), err
+}
+
+func TestValueList(t *testing.T) {
+	runValueTests(t, nil, []valueTest{
+		{"text", "<p>", "</p>", List{"a<", "b"}, "<p>a&lt;b</p>"},
+		{"URL scheme split between elements", `<a href="`, `">x</a>`, List{"javascript", ":alert(1)"}, `<a href="#ZgotmplZ">x</a>`},
+		{"unquoted attribute", `<a href=`, `>x</a>`, List{"javascript", ":alert(1)"}, `<a href="#ZgotmplZ">x</a>`},
+		{"safe URL", `<a href="`, `">x</a>`, List{"/a", "?q=1"}, `<a href="/a?q=1">x</a>`},
+		{"JS", `<script>var x = `, `;</script>`, List{"a", List{"b"}}, `<script>var x = "ab";</script>`},
+	})
+}
+
+func TestAttrList(t *testing.T) {
+	var b strings.Builder
+	e := New(&b)
+	e.Literal("<a")
+	if err := e.Attr("href", List{"javascript", ":alert(1)"}); err != nil {
+		t.Fatal(err)
+	}
+	e.Literal(">")
+	if got, want := b.String(), `<a href="#ZgotmplZ">`; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestStrictSVGUse(t *testing.T) {
+	for _, unquoted := range []bool{false, true} {
+		for _, tt := range []struct {
+			value, want string
+		}{
+			{"evil.svg#y", `<svg><use href="#ZgotmplZ"></use></svg>`},
+			{"#icon", `<svg><use href="#icon"></use></svg>`},
+		} {
+			if unquoted {
+				tt.want = strings.Replace(tt.want, `"`, "", -1)
+			}
+			var b strings.Builder
+			e := New(&b)
+			e.StrictSVGUse = true
+			e.PreferUnquoted = unquoted
+			e.Literal("<svg><use")
+			if err := e.Attr("href", tt.value); err != nil {
+				t.Fatal(err)
+			}
+			e.Literal("></use></svg>")
+			if got := b.String(); got != tt.want {
+				t.Errorf("PreferUnquoted=%v, %q: got %q, want %q", unquoted, tt.value, got, tt.want)
+			}
+		}
+	}
+	runValueTests(t, func(e *Escaper) { e.StrictSVGUse = true }, []valueTest{
+		{"quoted", `<svg><use href="`, `"></use></svg>`, "evil.svg#y", `<svg><use href="#ZgotmplZ"></use></svg>`},
+		{"auto-quoted", `<svg><use href=`, `></use></svg>`, "evil.svg#y", `<svg><use href="#ZgotmplZ"></use></svg>`},
+		{"external", `<svg><use href="`, `"></use></svg>`, "https://evil.com/x.svg#y", `<svg><use href="#ZgotmplZ"></use></svg>`},
+		{"xlink", `<svg><use xlink:href="`, `"></use></svg>`, "https://evil.com/x.svg#y", `<svg><use xlink:href="#ZgotmplZ"></use></svg>`},
+		{"xlink fragment", `<svg><use xlink:href="`, `"></use></svg>`, "#icon", `<svg><use xlink:href="#icon"></use></svg>`},
+		{"fragment after literal", `<svg><use href="#`, `"></use></svg>`, "a b", `<svg><use href="#a%20b"></use></svg>`},
+		{"other element", `<svg><image href="`, `"></image></svg>`, "x.png", `<svg><image href="x.png"></image></svg>`},
+	})
+	runValueTests(t, nil, []valueTest{
+		{"not strict", `<svg><use href="`, `"></use></svg>`, "https://x.com/x.svg#y", `<svg><use href="https://x.com/x.svg#y"></use></svg>`},
+		{"not strict javascript", `<svg><use href="`, `"></use></svg>`, "javascript:alert(1)", `<svg><use href="#ZgotmplZ"></use></svg>`},
+	})
+}
+
+func TestValueAfterLT(t *testing.T) {
+	runValueTests(t, nil, []valueTest{
+		{"number", "<p>1 <", "</p>", 2, "<p>1 <2</p>"},
+		{"space", "<p>a <", "</p>", " b", "<p>a < b</p>"},
+		{"script", "<", ">alert(1)</script>", "script", "<ZgotmplZ>alert(1)</script>"},
+		{"attribute", "<", ">", "img src=x onerror=alert(1)", "<ZgotmplZ>"},
+		{"end tag", "<", ">", "/p", "<ZgotmplZ>"},
+		{"comment", "<", "", "!-- x", "<ZgotmplZ"},
+		{"processing instruction", "<", ">", "?x", "<ZgotmplZ>"},
+		{"after </", "</", ">", "p", "</ZgotmplZ>"},
+		{"empty", "<", ">", "", "<>"},
+	})
+	if got, err := render(nil, "<p>1 <", 2, "</p>"); err != nil || got != "<p>1 <2</p>" {
+		t.Errorf("Print: got %q, %v", got, err)
+	}
+}
+
+func TestPrintf(t *testing.T) {
+	tests := []struct {
+		format string
+		args   []interface{}
+		want   string
+		ok     bool
+	}{
+		{`<p title="%s">%d%%</p>`, []interface{}{`a"b`, 5}, `<p title="a&#34;b">5%</p>`, true},
+		{`<a href="/x?n=%.2f">%v</a>`, []interface{}{1.5, "<b>"}, `<a href="/x?n=1.50">&lt;b&gt;</a>`, true},
+		{`<p>%[1]s</p>`, []interface{}{"a"}, "", false},
+		{`<p>%*d</p>`, []interface{}{3, 4}, "", false},
+		{`<p>%.*f</p>`, []interface{}{3, 4.0}, "", false},
+		{`<p>%y</p>`, []interface{}{"a"}, "", false},
+		{`<p>%s %s</p>`, []interface{}{"a"}, "", false},
+		{`<p>%s</p>`, []interface{}{"a", "b"}, "", false},
+		{`<p>50%`, nil, "", false},
+	}
+	for _, tt := range tests {
+		var b strings.Builder
+		e := New(&b)
+		err := e.Printf(tt.format, tt.args...)
+		if tt.ok != (err == nil) {
+			t.Errorf("Printf(%q): error %v", tt.format, err)
+			continue
+		}
+		if !tt.ok && !errors.Is(err, ErrBadArg) {
+			t.Errorf("Printf(%q): got %v, want ErrBadArg", tt.format, err)
+		}
+		if got := b.String(); got != tt.want {
+			t.Errorf("Printf(%q): got %q, want %q", tt.format, got, tt.want)
+		}
+	}
+}
+
+func TestRestoreContext(t *testing.T) {
+	var b strings.Builder
+	e := New(&b)
+	e.Literal("<div>")
+	for _, fail := range []bool{true, false} {
+		var buf bytes.Buffer
+		w := New(&buf)
+		w.RestoreContext(e.SaveContext())
+		w.Literal(`<a href="`)
+		w.Value("/x")
+		if fail {
+			// An error leaves w in the middle of an attribute.
+			w.Literal(`"<`)
+			w.Literal(`<`)
+		} else {
+			w.Literal(`">x</a>`)
+		}
+		if err := w.Finish(); err == nil {
+			e.LiteralBytes(buf.Bytes())
+		} else {
+			e.Literal("<p>Widget unavailable.</p>")
+		}
+	}
+	e.Literal("</div>")
+	if err := e.Finish(); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := b.String(), `<div><p>Widget unavailable.</p><a href="/x">x</a></div>`; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	// Restoring a context saved before an error clears the error.
+	saved := e.SaveContext()
+	if err := e.Literal(`<a href="x"<`); err == nil {
+		t.Fatal("no error for malformed tag")
+	}
+	e.RestoreContext(saved)
+	if err := e.Literal("<p>"); err != nil {
+		t.Errorf("after RestoreContext: %v", err)
+	}
+}
+
+func TestRequireQuotedAttrs(t *testing.T) {
+	runValueTests(t, func(e *Escaper) { e.RequireQuotedAttrs = true }, []valueTest{
+		{"quoted", `<a href="/x/`, `">`, "y", `<a href="/x/y">`},
+		{"text", `<p>`, `</p>`, "y", `<p>y</p>`},
+	})
+
+	for _, before := range []string{`<a href=`, `<a href=/x/`} {
+		var b strings.Builder
+		var reported []error
+		e := New(&b)
+		e.RequireQuotedAttrs = true
+		e.OnError = func(err error) { reported = append(reported, err) }
+		e.Literal(before)
+		err := e.Value("y")
+		if !errors.Is(err, ErrBadHTML) {
+			t.Errorf("%s: got %v, want ErrBadHTML", before, err)
+		}
+		if len(reported) != 1 || reported[0] != err {
+			t.Errorf("%s: OnError got %v", before, reported)
+		}
+		if err2 := e.Literal(">"); err2 != err {
+			t.Errorf("%s: error is not sticky; got %v", before, err2)
+		}
+		if b.String() != before {
+			t.Errorf("%s: got %q", before, b.String())
+		}
+	}
+
+	runValueTests(t, func(e *Escaper) {
+		e.RequireQuotedAttrs = true
+		e.ErrorPolicy = WriteFailsafe
+	}, []valueTest{
+		{"WriteFailsafe", `<a title=`, `>`, "y", `<a title="ZgotmplZ">`},
+		{"WriteFailsafe unquoted", `<a title=x`, `>`, "y", `<a title=xZgotmplZ>`},
+	})
+
+	defer func() {
+		if recover() == nil {
+			t.Error("PanicOnError: no panic")
+		}
+	}()
+	e := New(new(bytes.Buffer))
+	e.RequireQuotedAttrs = true
+	e.ErrorPolicy = PanicOnError
+	e.Literal(`<a title=`)
+	e.Value("y")
+}
+
+func TestSetOutputFilter(t *testing.T) {
+	tests := []struct {
+		name  string
+		write func(e *Escaper) error
+		want  string
+	}{
+		{"Literal", func(e *Escaper) error { return e.Literal("<p>hi</p>") }, "<P>HI</P>"},
+		{"Value", func(e *Escaper) error { return e.Value("a<b") }, "A&LT;B"},
+		{"Print", func(e *Escaper) error { return e.Print(`<a href="`, "/x y", `">z</a>`) }, `<A HREF="/X%20Y">Z</A>`},
+		{"Write", func(e *Escaper) error { _, err := e.Write([]byte("<b>x</b>")); return err }, "<B>X</B>"},
+		{"Attr", func(e *Escaper) error {
+			e.Literal("<p")
+			if err := e.Attr("title", "t"); err != nil {
+				return err
+			}
+			return e.Literal(">")
+		}, `<P TITLE="T">`},
+	}
+	for _, tt := range tests {
+		var b strings.Builder
+		e := New(&b)
+		e.SetOutputFilter(bytes.ToUpper)
+		if err := tt.write(e); err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if got := b.String(); got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+
+	// The filter doesn't change the context the escaper keeps track of.
+	var b strings.Builder
+	e := New(&b)
+	e.SetOutputFilter(bytes.ToUpper)
+	e.Print("<script>var x = ", "a", ";</script>")
+	e.SetOutputFilter(nil)
+	e.Print("<p>", "a", "</p>")
+	if got, want := b.String(), `<SCRIPT>VAR X = "A";</SCRIPT><p>a</p>`; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestAppendEscaped(t *testing.T) {
+	contexts := []string{
+		"<p>",
+		"<title>",
+		"<textarea>",
+		`<a title="`,
+		`<a title='`,
+		`<a title=`,
+		`<a title=x`,
+		`<a href="`,
+		`<a href="/x?q=`,
+		`<img srcset="`,
+		`<p style="color: `,
+		`<p onclick="f(`,
+		"<script>var x = ",
+		"<script>var s = '",
+		"<style>p { color: ",
+		"<!-- ",
+	}
+	values := []string{"", "a b", `"'<>&`, "javascript:alert(1)", "/café?q=1", "</script>"}
+	for _, before := range contexts {
+		for _, v := range values {
+			var b strings.Builder
+			e := New(&b)
+			e.Literal(before)
+			ci := e.Context()
+			b.Reset()
+			err := e.Value(v)
+			want := b.String()
+
+			got, aerr := AppendEscaped([]byte("prefix"), ci, []byte(v))
+			if (err == nil) != (aerr == nil) {
+				t.Errorf("%s%q: AppendEscaped error %v, Value error %v", before, v, aerr, err)
+				continue
+			}
+			if err != nil {
+				continue
+			}
+			if string(got) != "prefix"+want {
+				t.Errorf("%s%q: AppendEscaped gave %q, Value wrote %q", before, v, got, want)
+			}
+		}
+	}
+
+	e := New(io.Discard)
+	e.Literal(`<a href="x"<`)
+	if _, err := AppendEscaped(nil, e.Context(), []byte("x")); err == nil {
+		t.Error("no error in error context")
+	}
+}
+
+func TestPrintChan(t *testing.T) {
+	tests := []struct {
+		name  string
+		frags []template.HTML
+		value interface{}
+		want  string
+		err   bool
+	}{
+		{
+			"three fragments",
+			[]template.HTML{"<ul>", "<li>a</li>", "<li>b</li></ul>"},
+			nil,
+			"<ul><li>a</li><li>b</li></ul>",
+			false,
+		},
+		{
+			"context carries over",
+			[]template.HTML{`<a href="`, "/x?q=1", `">`},
+			"a b",
+			`<a href="/x?q=1">a b`,
+			false,
+		},
+		{
+			"ends in script",
+			[]template.HTML{"<script>", "var x = "},
+			"</script>",
+			`<script>var x = "\u003c/script\u003e"`,
+			false,
+		},
+		{
+			"error",
+			[]template.HTML{"<p>", `<a href="x"<`, "<p>not written</p>"},
+			nil,
+			"<p>",
+			true,
+		},
+	}
+	for _, tt := range tests {
+		ch := make(chan template.HTML)
+		go func() {
+			defer close(ch)
+			for _, f := range tt.frags {
+				ch <- f
+			}
+		}()
+		var b strings.Builder
+		e := New(&b)
+		err := e.PrintChan(ch)
+		if tt.err {
+			if err == nil {
+				t.Errorf("%s: no error", tt.name)
+			}
+			// Let the sender finish.
+			for range ch {
+			}
+		} else if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if tt.value != nil {
+			if err := e.Value(tt.value); err != nil {
+				t.Errorf("%s: %v", tt.name, err)
+			}
+		}
+		if got := b.String(); got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestSaveContext(t *testing.T) {
+	tests := []struct {
+		name   string
+		start  string
+		branch string
+		value  string
+		want   string
+	}{
+		{"text after attribute", "<p>", `<a title="`, "<x>", "<p>&lt;x&gt;"},
+		{"text after script", "<p>", "<script>var x = ", "a b", "<p>a b"},
+		{"attribute after text", `<a title="`, `">`, `"x"`, `<a title="&#34;x&#34;`},
+		{"script after comment", "<script>var x = ", "/* ", "x", `<script>var x = "x"`},
+		{"after error", "<p>", `<a href="x"<`, "<x>", "<p>&lt;x&gt;"},
+	}
+	for _, tt := range tests {
+		var b strings.Builder
+		e := New(&b)
+		e.Literal(tt.start)
+		saved := e.SaveContext()
+		n := b.Len()
+
+		// The abandoned branch.
+		e.Literal(tt.branch)
+		e.Value(tt.value)
+
+		e.RestoreContext(saved)
+		out := b.String()[:n]
+		b.Reset()
+		b.WriteString(out)
+		if err := e.Value(tt.value); err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if got := b.String(); got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestReset(t *testing.T) {
+	tests := []struct {
+		name   string
+		before string
+		value  interface{}
+		want   string
+	}{
+		{"after text", "<p>", "<x>", "<p>&lt;x&gt;</p>"},
+		{"after script", "<script>var x = ", "<x>", "<p>&lt;x&gt;</p>"},
+		{"after attribute", `<a title="`, `"x"`, "<p>&#34;x&#34;</p>"},
+		{"after error", `<a href="x"<`, "<x>", "<p>&lt;x&gt;</p>"},
+		{"failsafe kept", "", "javascript:alert(1)", `<p><a href="blocked">x</a></p>`},
+	}
+	for _, tt := range tests {
+		var b1, b2 strings.Builder
+		e := New(&b1)
+		e.SetFailsafe("blocked")
+		e.Literal(tt.before)
+		e.Value(tt.value)
+
+		e.Reset(&b2)
+		var err error
+		if tt.name == "failsafe kept" {
+			err = e.Print(`<p><a href="`, tt.value, `">x</a></p>`)
+		} else {
+			err = e.Print("<p>", tt.value, "</p>")
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if got := b2.String(); got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestSetFailsafe(t *testing.T) {
+	tests := []struct {
+		name          string
+		before, after string
+		value         interface{}
+	}{
+		{"URL", `<a href="`, `">`, "javascript:alert(1)"},
+		{"unquoted URL", `<a href=`, `>`, "javascript:alert(1)"},
+		{"CSS", `<p style="color: `, `">`, "expression(x)"},
+		{"attribute name", `<a `, `="x">`, "onclick"},
+		{"tag name", `<`, `>`, "script"},
+	}
+	failsafes := []struct {
+		failsafe string
+		want     []string
+	}{
+		{"", []string{`<a href="">`, `<a href="">`, `<p style="color: ">`, `<a ="x">`, `<>`}},
+		{"blocked", []string{`<a href="blocked">`, `<a href="blocked">`, `<p style="color: blocked">`, `<a blocked="x">`, `<blocked>`}},
+	}
+	for _, f := range failsafes {
+		var vts []valueTest
+		for i, tt := range tests {
+			vts = append(vts, valueTest{tt.name, tt.before, tt.after, tt.value, f.want[i]})
+		}
+		runValueTests(t, func(e *Escaper) { e.SetFailsafe(f.failsafe) }, vts)
+	}
+}
+
+func TestValueFrom(t *testing.T) {
+	const value = `a<b>"c' & é</script> javascript:x `
+	tests := []struct {
+		name, before, after string
+	}{
+		{"text", "<p>", "</p>"},
+		{"RCDATA", "<title>", "</title>"},
+		{"attribute", `<p title="`, `">`},
+		{"single-quoted attribute", `<p title='`, `'>`},
+		{"before value", `<p title=`, `>`},
+		{"unquoted", `<p title=x`, `>`},
+		{"JS string", `<script>var x = "`, `";</script>`},
+		{"JS string in attribute", `<a onclick="f('`, `')">`},
+		{"URL", `<a href="`, `">`},
+		{"URL query", `<a href="/?q=`, `">`},
+		{"CSS", `<p style="color: `, `">`},
+		{"comment", "<!-- ", " -->"},
+		{"lang", `<p lang="`, `">`},
+	}
+	for _, tt := range tests {
+		var want strings.Builder
+		e := New(&want)
+		e.Print(tt.before, value, tt.after)
+
+		var got strings.Builder
+		e = New(&got)
+		e.Literal(tt.before)
+		if err := e.ValueFrom(iotest.OneByteReader(strings.NewReader(value))); err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		e.Literal(tt.after)
+		if got.String() != want.String() {
+			t.Errorf("%s: got %q, want %q", tt.name, got.String(), want.String())
+		}
+	}
+
+	// In JS code, the value is written as a string literal, with the same
+	// escaping as in a string.
+	var b strings.Builder
+	e := New(&b)
+	e.Literal("<script>var x = ")
+	if err := e.ValueFrom(iotest.OneByteReader(strings.NewReader(value))); err != nil {
+		t.Fatal(err)
+	}
+	e.Literal(";</script>")
+	want, _ := render(nil, `<script>var x = "`, value, `";</script>`)
+	if b.String() != want {
+		t.Errorf("JS: got %q, want %q", b.String(), want)
+	}
+
+	e = New(io.Discard)
+	e.Literal("<p>")
+	readErr := errors.New("read error")
+	if err := e.ValueFrom(iotest.ErrReader(readErr)); err != readErr {
+		t.Errorf("read error: got %v", err)
+	}
+}
+
+func TestExecuteTemplate(t *testing.T) {
+	tmpl := template.Must(template.New("").Parse(`<p title="{{.Title}}">{{.Body}}</p>{{.Raw}}`))
+	tests := []struct {
+		name  string
+		raw   template.HTML
+		value string
+		want  string
+	}{
+		{"text", "", "<x>", `<p title="a&#34;b">&lt;b&gt;</p>&lt;x&gt;`},
+		{"script", "<script>var x = ", "</script>", `<p title="a&#34;b">&lt;b&gt;</p><script>var x = "\u003c/script\u003e"`},
+		{"attribute", `<a href="`, "javascript:x", `<p title="a&#34;b">&lt;b&gt;</p><a href="#ZgotmplZ`},
+	}
+	for _, tt := range tests {
+		var b strings.Builder
+		e := New(&b)
+		data := map[string]interface{}{"Title": `a"b`, "Body": "<b>", "Raw": tt.raw}
+		if err := e.ExecuteTemplate(tmpl, data); err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		// The Escaper keeps track of the context that the template's
+		// output ends in.
+		if err := e.Value(tt.value); err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if got := b.String(); got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+
+	e := New(io.Discard)
+	e.Literal(`<a title="`)
+	if err := e.ExecuteTemplate(tmpl, nil); !errors.Is(err, ErrHelperContext) {
+		t.Errorf("in attribute: got %v, want ErrHelperContext", err)
+	}
+
+	execErr := errors.New("exec error")
+	bad := template.Must(template.New("").Parse(`<p>{{call .}}</p>`))
+	if err := New(io.Discard).ExecuteTemplate(bad, func() (string, error) { return "", execErr }); !errors.Is(err, execErr) {
+		t.Errorf("template error: got %v", err)
+	}
+
+	// Output that html/template considers safe, but that the Escaper can't
+	// parse, is an error.
+	raw := template.Must(template.New("").Parse(`{{.}}`))
+	if err := New(io.Discard).ExecuteTemplate(raw, template.HTML(`<a href="x"<`)); !errors.Is(err, ErrBadHTML) {
+		t.Errorf("bad HTML: got %v, want ErrBadHTML", err)
+	}
+}
+
+// money is a fmt.Formatter that uses the precision for the number of
+// decimal places.
+type money int64
+
+func (m money) Format(f fmt.State, verb rune) {
+	prec, ok := f.Precision()
+	if !ok {
+		prec = 2
+	}
+	fmt.Fprintf(f, "$%.*f", prec, float64(m)/100)
+}
+
+func TestFormat(t *testing.T) {
+	runValueTests(t, nil, []valueTest{
+		{"text", "<p>", "</p>", Format("%.2f", 3.14159), "<p>3.14</p>"},
+		{"escaped", "<p>", "</p>", Format("%q", "<b>"), "<p>&#34;&lt;b&gt;&#34;</p>"},
+		{"attribute", `<td data-x="`, `">`, Format("%05d", 42), `<td data-x="00042">`},
+		{"JS number", "<script>var x = ", ";</script>", Format("%.1f", 2.25), "<script>var x =  2.2 ;</script>"},
+		{"JS padded number", "<script>var x = ", ";</script>", Format("%5d", 42), `<script>var x = "   42";</script>`},
+		{"JS hex", "<script>var x = ", ";</script>", Format("%x", 255), `<script>var x = "ff";</script>`},
+		{"JS string", "<script>var x = ", ";</script>", Format("%s!", "a<"), `<script>var x = "a\u003c!";</script>`},
+		{"JS in string", `<script>var x = "`, `";</script>`, Format("%.1f", 2.25), `<script>var x = "2.2";</script>`},
+		{"Formatter", "<p>", "</p>", Format("%.0v", money(1250)), "<p>$12</p>"},
+		{"Formatter default", "<p>", "</p>", Format("%v", money(1250)), "<p>$12.50</p>"},
+		{"URL", `<a href="/p?n=`, `">`, Format("%.1f", 0.5), `<a href="/p?n=0.5">`},
+	})
+}
+
+func TestCommentValues(t *testing.T) {
+	runValueTests(t, nil, []valueTest{
+		{"default HTML", "<!-- ", " -->", "<b>", "<!--  -->"},
+		{"default bogus", "<!x ", ">", "<b>", "<!x >"},
+		{"default JS", "<script>/* ", " */</script>", "x", "<script>/*  */</script>"},
+	})
+	runValueTests(t, func(e *Escaper) { e.CommentValues = DropCommentValues }, []valueTest{
+		{"HTML", "<!-- ", " -->", "x", "<!--  -->"},
+		{"CSS", "<style>/* ", " */</style>", "x", "<style>/*  */</style>"},
+	})
+	runValueTests(t, func(e *Escaper) { e.CommentValues = EscapeCommentValues }, []valueTest{
+		{"HTML", "<!-- ", " -->", "x", "<!-- x -->"},
+		{"conditional", "<!--[if IE]><p>", "</p><![endif]-->", "<b>", "<!--[if IE]><p>&lt;b&gt;</p><![endif]-->"},
+		{"comment end", "<!-- ", " -->", "--> <script>", "<!-- --&gt; &lt;script&gt; -->"},
+		{"bogus", "<!x ", ">", "> <b>", "<!x &gt; &lt;b&gt;>"},
+		{"JS block", "<script>/* ", " */</script>", "*/ alert(1)", "<script>/*  */</script>"},
+		{"JS line", "<script>// ", "\n</script>", "x", "<script>// \n</script>"},
+		{"CSS", "<style>/* ", " */</style>", "x", "<style>/*  */</style>"},
+	})
+
+	for _, before := range []string{"<!-- ", "<!x ", "<script>/* ", "<style>/* "} {
+		e := New(io.Discard)
+		e.CommentValues = RejectCommentValues
+		e.Literal(before)
+		if err := e.Value("x"); !errors.Is(err, ErrCommentValue) {
+			t.Errorf("RejectCommentValues in %q: got %v, want ErrCommentValue", before, err)
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package escaper
+
+import "bytes"
+
+// A Fragment is a piece of output that has already been escaped, together
+// with the state of the Escaper before and after it. A Fragment can be cached
+// and written again with WriteFragment, without escaping its values or
+// parsing its HTML again.
+type Fragment struct {
+	html       string
+	start, end escaperState
+}
+
+// HTML returns the output in f.
+func (f *Fragment) HTML() string {
+	return f.html
+}
+
+// escaperState is the part of an Escaper's state that affects how the
+// output that follows is escaped.
+type escaperState struct {
+	ci             ContextInfo
+	pretty         prettyState
+	san            sanitizeState
+	stripping      bool
+	open, unclosed []string
+}
+
+func (e *Escaper) snapshot() escaperState {
+	return escaperState{
+		ci:        e.Context(),
+		pretty:    e.pretty,
+		san:       e.san,
+		stripping: e.stripping,
+		open:      append([]string(nil), e.open...),
+		unclosed:  append([]string(nil), e.unclosed...),
+	}
+}
+
+func (s escaperState) equal(t escaperState) bool {
+	return fragmentKey(s.ci) == fragmentKey(t.ci) && s.pretty == t.pretty && s.san == t.san && s.stripping == t.stripping && equalStrings(s.open, t.open) && equalStrings(s.unclosed, t.unclosed)
+}
+
+// fragmentKey returns ci without the details of the most recent tag if they
+// can't affect the output that follows. In HTML text, only the open foreign
+// and template elements, and whether a leading newline would be dropped,
+// matter; otherwise a Fragment could only be written after the same tag that
+// it was captured after.
+func fragmentKey(ci ContextInfo) ContextInfo {
+	if ci.InTag() || ci.c.element != elementNone {
+		return ci
+	}
+	t := ci.tag
+	ci.tag = tagInfo{dropsNewline: t.dropsNewline, foreign: t.foreign, templates: t.templates}
+	return ci
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Capture calls render with an Escaper that has the same settings and state
+// as e, but writes to a buffer, and returns what it wrote as a Fragment. The
+// output filter is not applied until the Fragment is written. e itself is
+// not changed.
+func (e *Escaper) Capture(render func(e *Escaper) error) (*Fragment, error) {
+	if err := e.stickyError(); err != nil {
+		return nil, err
+	}
+	start := e.snapshot()
+	var b bytes.Buffer
+	sub := *e
+	sub.w = &b
+	sub.filter = nil
+	sub.open, sub.unclosed = start.open, start.unclosed
+	if err := render(&sub); err != nil {
+		return nil, err
+	}
+	if err := sub.stickyError(); err != nil {
+		return nil, err
+	}
+	// Copy the slices again, since sub may have changed them in place.
+	start.open = append([]string(nil), e.open...)
+	start.unclosed = append([]string(nil), e.unclosed...)
+	return &Fragment{html: b.String(), start: start, end: sub.snapshot()}, nil
+}
+
+// WriteFragment writes f, which must have been captured by an Escaper with the
+// same settings, in the same state that e is in now; otherwise it returns an
+// error. Afterward, e is in the state that f ended in.
+func (e *Escaper) WriteFragment(f *Fragment) error {
+	if err := e.stickyError(); err != nil {
+		return err
+	}
+	if !e.snapshot().equal(f.start) {
+		return errorf(ErrHelperContext, "WriteFragment called in %v, not in the state the fragment was captured in", e.ctx.state)
+	}
+	if _, err := e.writeString(f.html); err != nil {
+		return err
+	}
+	e.advance(f.html)
+	end := f.end
+	e.RestoreContext(end.ci)
+	e.pretty, e.san, e.stripping = end.pretty, end.san, end.stripping
+	e.open = append(e.open[:0], end.open...)
+	e.unclosed = append(e.unclosed[:0], end.unclosed...)
+	return nil
+}
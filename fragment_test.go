@@ -0,0 +1,117 @@
+package escaper
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestFragment(t *testing.T) {
+	var b strings.Builder
+	e := New(&b)
+	e.Literal("<ul>")
+	f, err := e.Capture(func(e *Escaper) error {
+		return e.Print("<li>", "a<b", "</li>")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := f.HTML(), "<li>a&lt;b</li>"; got != want {
+		t.Errorf("HTML() = %q, want %q", got, want)
+	}
+	if got := b.String(); got != "<ul>" {
+		t.Errorf("Capture wrote %q to the Escaper", got[len("<ul>"):])
+	}
+	for i := 0; i < 2; i++ {
+		if err := e.WriteFragment(f); err != nil {
+			t.Fatal(err)
+		}
+	}
+	e.Literal("</ul>")
+	if got, want := b.String(), "<ul><li>a&lt;b</li><li>a&lt;b</li></ul>"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestFragmentContext(t *testing.T) {
+	// A fragment that ends in a different context leaves the Escaper in
+	// that context.
+	var b strings.Builder
+	e := New(&b)
+	f, err := e.Capture(func(e *Escaper) error {
+		return e.Literal(`<a href="`)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	e.WriteFragment(f)
+	e.Value("javascript:x")
+	e.Literal(`">`)
+	if got, want := b.String(), `<a href="#ZgotmplZ">`; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	// It can't be written in a different context.
+	tests := []struct {
+		name   string
+		before string
+		setup  func(e *Escaper)
+	}{
+		{"attribute", `<a title="`, nil},
+		{"script", "<script>", nil},
+		{"SVG", "<svg>", nil},
+		{"template", "<template>", nil},
+		{"after pre", "<pre>", nil},
+		{"open element", "<div>", func(e *Escaper) { e.CheckTagBalance = true }},
+	}
+	for _, tt := range tests {
+		e := New(new(bytes.Buffer))
+		if tt.setup != nil {
+			tt.setup(e)
+		}
+		f, err := e.Capture(func(e *Escaper) error { return e.Literal("<p>") })
+		if err != nil {
+			t.Fatal(err)
+		}
+		e.Literal(tt.before)
+		if err := e.WriteFragment(f); !errors.Is(err, ErrHelperContext) {
+			t.Errorf("%s: got %v, want ErrHelperContext", tt.name, err)
+		}
+	}
+}
+
+func TestFragmentErrors(t *testing.T) {
+	e := New(new(bytes.Buffer))
+	renderErr := errors.New("render failed")
+	if _, err := e.Capture(func(e *Escaper) error { return renderErr }); err != renderErr {
+		t.Errorf("render error: got %v", err)
+	}
+	if _, err := e.Capture(func(e *Escaper) error {
+		e.Literal(`<a href="x"<`)
+		return nil
+	}); !errors.Is(err, ErrBadHTML) {
+		t.Errorf("escaping error: got %v, want ErrBadHTML", err)
+	}
+	// The error in the capture doesn't affect e.
+	if err := e.Literal("<p>"); err != nil {
+		t.Errorf("after failed Capture: %v", err)
+	}
+}
+
+func TestFragmentOutputFilter(t *testing.T) {
+	var b strings.Builder
+	e := New(&b)
+	e.SetOutputFilter(bytes.ToUpper)
+	f, err := e.Capture(func(e *Escaper) error { return e.Literal("<p>a</p>") })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := f.HTML(); got != "<p>a</p>" {
+		t.Errorf("HTML() = %q", got)
+	}
+	e.WriteFragment(f)
+	if got := b.String(); got != "<P>A</P>" {
+		t.Errorf("got %q", got)
+	}
+}
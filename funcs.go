@@ -0,0 +1,79 @@
+package escaper
+
+import texttemplate "text/template"
+
+// These functions escape a single value for one context, the same way an
+// Escaper escapes values in that context. They are useful for building
+// strings outside of an Escaper's output. Trusted content types (such as
+// HTML for EscapeHTML) are handled the same way as they are by Value.
+
+// EscapeHTML escapes v for HTML text.
+func EscapeHTML(v interface{}) string {
+	return htmlEscaper(v)
+}
+
+// EscapeHTMLAttr escapes v for a quoted HTML attribute value.
+func EscapeHTMLAttr(v interface{}) string {
+	return attrEscaper(v)
+}
+
+// EscapeJSString escapes v for the inside of a quoted JavaScript string. The
+// quotes are not included.
+func EscapeJSString(v interface{}) string {
+	return jsStrEscaper(v)
+}
+
+// EscapeJSValue converts v to a JavaScript expression, usually by encoding it
+// as JSON.
+func EscapeJSValue(v interface{}) string {
+	return jsValEscaper(v)
+}
+
+// EscapeCSS escapes v for a CSS string or identifier.
+func EscapeCSS(v interface{}) string {
+	return cssEscaper(v)
+}
+
+// EscapeURL escapes v for a URL query parameter or path segment, by
+// percent-encoding everything but unreserved characters.
+func EscapeURL(v interface{}) string {
+	return urlEscaper(v)
+}
+
+// NormalizeURL percent-encodes the characters in v that are not allowed in
+// URLs, leaving the URL's structure intact. It does not check the URL's
+// scheme; unsafe URLs such as "javascript:..." are returned unchanged.
+func NormalizeURL(v interface{}) string {
+	return urlNormalizer(v)
+}
+
+// FuncMap returns the escaping functions for use in text/template templates
+// that generate HTML, for programs that don't use html/template or an
+// Escaper:
+//
+//	escHTML    EscapeHTML
+//	escAttr    EscapeHTMLAttr
+//	escJS      EscapeJSValue
+//	escJSStr   EscapeJSString
+//	escCSS     EscapeCSS
+//	escURL     EscapeURL
+//	normURL    NormalizeURL
+//	filterURL  replaces a URL with an unsafe scheme, such as
+//	           "javascript:", with "#ZgotmplZ"
+//
+// Unlike with an Escaper, the template author must choose the right
+// function for each context. For example, a link would be written as:
+//
+//	<a href="{{.URL | filterURL | normURL | escAttr}}">{{.Text | escHTML}}</a>
+func FuncMap() texttemplate.FuncMap {
+	return texttemplate.FuncMap{
+		"escHTML":   EscapeHTML,
+		"escAttr":   EscapeHTMLAttr,
+		"escJS":     EscapeJSValue,
+		"escJSStr":  EscapeJSString,
+		"escCSS":    EscapeCSS,
+		"escURL":    EscapeURL,
+		"normURL":   NormalizeURL,
+		"filterURL": func(v interface{}) string { return urlFilter(v) },
+	}
+}
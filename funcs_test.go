@@ -0,0 +1,66 @@
+package escaper
+
+import (
+	"strings"
+	"testing"
+	texttemplate "text/template"
+)
+
+func TestEscapeFuncs(t *testing.T) {
+	tests := []struct {
+		name string
+		f    func(interface{}) string
+		in   interface{}
+		want string
+	}{
+		{"EscapeHTML", EscapeHTML, `<a href="x">&'`, "&lt;a href=&#34;x&#34;&gt;&amp;&#39;"},
+		{"EscapeHTML trusted", EscapeHTML, HTML("<b>"), "<b>"},
+		{"EscapeHTML number", EscapeHTML, 42, "42"},
+		{"EscapeHTMLAttr", EscapeHTMLAttr, `"x" <y>`, "&#34;x&#34; &lt;y&gt;"},
+		{"EscapeHTMLAttr HTML", EscapeHTMLAttr, HTML("<b>x</b>"), "x"},
+		{"EscapeJSString", EscapeJSString, `a"b'</script>`, `a\x22b\x27\x3c\/script\x3e`},
+		{"EscapeJSValue string", EscapeJSValue, "a</script>", `"a\u003c/script\u003e"`},
+		{"EscapeJSValue map", EscapeJSValue, map[string]int{"a": 1}, `{"a":1}`},
+		{"EscapeJSValue trusted", EscapeJSValue, JS("f()"), "f()"},
+		{"EscapeCSS", EscapeCSS, `a"b</style>`, `a\22 b\3c\2fstyle\3e `},
+		{"EscapeURL", EscapeURL, "a b/c?d=e&f", "a%20b%2Fc%3Fd%3De%26f"},
+		{"NormalizeURL", NormalizeURL, "/a b/c?d=e&f", "/a%20b/c?d=e&f"},
+		{"NormalizeURL unsafe", NormalizeURL, "javascript:alert(1)", "javascript:alert%281%29"},
+	}
+	for _, tt := range tests {
+		if got := tt.f(tt.in); got != tt.want {
+			t.Errorf("%s(%q) = %q, want %q", tt.name, tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestFuncMap(t *testing.T) {
+	const src = `<a href="{{.URL | filterURL | normURL | escAttr}}" title="{{.Title | escAttr}}" onclick="f({{.Title | escJS | escAttr}})">{{.Text | escHTML}}</a>` +
+		`<script>var s = '{{.Text | escJSStr}}';</script><p style="font-family: '{{.Title | escCSS}}'"><a href="/q?s={{.Text | escURL}}">`
+	tmpl := texttemplate.Must(texttemplate.New("").Funcs(FuncMap()).Parse(src))
+	tests := []struct {
+		url, title, text string
+		want             string
+	}{
+		{
+			"/a b", `x"y`, "<b>",
+			`<a href="/a%20b" title="x&#34;y" onclick="f(&#34;x\&#34;y&#34;)">&lt;b&gt;</a>` +
+				`<script>var s = '\x3cb\x3e';</script><p style="font-family: 'x\22y'"><a href="/q?s=%3Cb%3E">`,
+		},
+		{
+			"javascript:alert(1)", "", "a&b",
+			`<a href="#ZgotmplZ" title="" onclick="f(&#34;&#34;)">a&amp;b</a>` +
+				`<script>var s = 'a\x26b';</script><p style="font-family: ''"><a href="/q?s=a%26b">`,
+		},
+	}
+	for _, tt := range tests {
+		var b strings.Builder
+		data := map[string]string{"URL": tt.url, "Title": tt.title, "Text": tt.text}
+		if err := tmpl.Execute(&b, data); err != nil {
+			t.Fatal(err)
+		}
+		if got := b.String(); got != tt.want {
+			t.Errorf("%q:\ngot  %q\nwant %q", tt.url, got, tt.want)
+		}
+	}
+}
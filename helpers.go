@@ -0,0 +1,575 @@
+package escaper
+
+import (
+	"fmt"
+	"mime"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// requireText returns an error unless e is in HTML text, where an element
+// can start.
+func (e *Escaper) requireText(helper string) error {
+	if err := e.stickyError(); err != nil {
+		return err
+	}
+	if e.ctx.state != stateText {
+		return errorf(ErrHelperContext, "%s called in %v, not in HTML text", helper, e.ctx.state)
+	}
+	return nil
+}
+
+// startScript writes a script start tag, with a type attribute if typ is not
+// empty, a src attribute if src is not nil, and a nonce attribute if e.Nonce
+// is set.
+func (e *Escaper) startScript(typ string, src interface{}) error {
+	tag := "<script"
+	if typ != "" {
+		tag += ` type="` + typ + `"`
+	}
+	if src != nil {
+		if err := e.Literal(tag + ` src="`); err != nil {
+			return err
+		}
+		if err := e.Value(src); err != nil {
+			return err
+		}
+		tag = `"`
+	}
+	if e.Nonce == "" || e.AutoNonce {
+		return e.Literal(tag + ">")
+	}
+	return e.Print(tag+` nonce="`, e.Nonce, `">`)
+}
+
+// ConfigScript writes a script element that assigns v, encoded as JSON, to
+// the global variable jsVar:
+//
+//	<script nonce="...">window.jsVar = {...};</script>
+//
+// jsVar must be an ASCII JavaScript identifier.
+func (e *Escaper) ConfigScript(jsVar string, v interface{}) error {
+	if err := e.requireText("ConfigScript"); err != nil {
+		return err
+	}
+	if !isJSIdentifier(jsVar) {
+		return errorf(ErrBadArg, "invalid JS identifier: %q", jsVar)
+	}
+	if err := e.startScript("", nil); err != nil {
+		return err
+	}
+	if err := e.Literal("window." + jsVar + " = "); err != nil {
+		return err
+	}
+	if err := e.Value(v); err != nil {
+		return err
+	}
+	return e.Literal(";</script>")
+}
+
+// requireStartTag returns an error unless e is inside a start tag, where an
+// attribute can be added.
+func (e *Escaper) requireStartTag(helper string) error {
+	if err := e.stickyError(); err != nil {
+		return err
+	}
+	switch {
+	case e.ctx.state == stateTag, e.ctx.state == stateAttrName, e.ctx.state == stateAfterName:
+	case e.ctx.delim == delimSpaceOrTagEnd:
+		// The space before the new attribute will end the unquoted value.
+	default:
+		return errorf(ErrHelperContext, "%s called in %v, not in a start tag", helper, e.ctx.state)
+	}
+	return nil
+}
+
+// isAttrName reports whether s is a valid attribute name made of ASCII
+// letters, digits, and punctuation that is commonly used in attribute names.
+func isAttrName(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case asciiAlphaNum(c), c == '-', c == '_', c == ':', c == '.':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// isUnquotedSafe reports whether s, which has been escaped for a quoted
+// attribute value, can be written without the quotes. A slash is not
+// allowed, since "<img src=a/>" looks like a self-closing tag.
+func isUnquotedSafe(s string) bool {
+	return s != "" && !strings.ContainsAny(s, " \t\n\f\r\"'`<=>/")
+}
+
+// isEmptyValue reports whether v is nil, a nil pointer, or a value that is
+// written as an empty string.
+func isEmptyValue(v interface{}) bool {
+	v = indirect(v)
+	if v == nil {
+		return true
+	}
+	if rv := reflect.ValueOf(v); rv.Kind() == reflect.Ptr && rv.IsNil() {
+		return true
+	}
+	if l, ok := v.(List); ok {
+		return joinList(l) == ""
+	}
+	s, _ := stringify(v)
+	return s == ""
+}
+
+// Attr writes an attribute with the given name and value, as
+// ` name="value"`. It must be called inside a start tag, for example after
+// Literal("<a"). The value is escaped the same way as if the attribute had
+// been written with Literal and Value: as a URL in href, as JavaScript in
+// onclick, and so on.
+//
+// If e.PreferUnquoted is set (and e.XML is not), the value is written without
+// quotes if it doesn't need them. If e.OmitEmptyAttrs is set, nothing is
+// written if the value is empty.
+func (e *Escaper) Attr(name string, value interface{}) error {
+	if err := e.requireStartTag("Attr"); err != nil {
+		return err
+	}
+	if !isAttrName(name) {
+		return errorf(ErrBadArg, "invalid attribute name: %q", name)
+	}
+	if e.OmitEmptyAttrs && isEmptyValue(value) {
+		return nil
+	}
+	if err := e.Literal(" " + name + "="); err != nil {
+		return err
+	}
+	return e.value(value, e.PreferUnquoted && !e.XML)
+}
+
+// BoolAttr writes a boolean attribute, such as disabled or checked, if
+// present is true, and nothing if it is false. It must be called inside a
+// start tag. The name is checked with the same filter that is used for
+// attribute names written with Value; names that would need escaping as
+// URLs, JavaScript, or CSS are not allowed. If e.XML is set, the attribute is
+// written with its name as its value, as in disabled="disabled".
+func (e *Escaper) BoolAttr(name string, present bool) error {
+	if err := e.requireStartTag("BoolAttr"); err != nil {
+		return err
+	}
+	filtered := htmlNameFilter(name)
+	if filtered == filterFailsafe {
+		return errorf(ErrBadArg, "invalid boolean attribute name: %q", name)
+	}
+	if !present {
+		return nil
+	}
+	if e.XML {
+		return e.Literal(" " + filtered + `="` + filtered + `"`)
+	}
+	return e.Literal(" " + filtered)
+}
+
+// isTagName reports whether s is a valid tag name, such as "div" or
+// "my-element".
+func isTagName(s string) bool {
+	j, _ := eatTagName(s, 0)
+	return s != "" && j == len(s)
+}
+
+// OpenTag starts an element with the given name, by writing "<" and the
+// name. It must be called in HTML text. Attributes can then be added with
+// Attr and the other attribute helpers, and the start tag is finished with
+// CloseStartTag:
+//
+//	e.OpenTag("a")
+//	e.Attr("href", url)
+//	e.CloseStartTag()
+//	e.Value(text)
+//	e.CloseTag("a")
+func (e *Escaper) OpenTag(name string) error {
+	if err := e.requireText("OpenTag"); err != nil {
+		return err
+	}
+	if !isTagName(name) {
+		return errorf(ErrBadArg, "invalid tag name: %q", name)
+	}
+	return e.Literal("<" + name)
+}
+
+// CloseStartTag writes the ">" that ends a start tag. It must be called
+// inside a start tag.
+func (e *Escaper) CloseStartTag() error {
+	if err := e.requireStartTag("CloseStartTag"); err != nil {
+		return err
+	}
+	return e.Literal(">")
+}
+
+// CloseTag writes the end tag for the element with the given name. It must
+// be called in HTML text, or in the content of the named element if it is a
+// script, style, textarea, or title element.
+func (e *Escaper) CloseTag(name string) error {
+	if err := e.stickyError(); err != nil {
+		return err
+	}
+	if !isTagName(name) {
+		return errorf(ErrBadArg, "invalid tag name: %q", name)
+	}
+	if e.ctx.state != stateText {
+		el := elementNameMap[strings.ToLower(name)]
+		if el == elementScript && e.ctx.element == elementJSONScript {
+			el = elementJSONScript
+		}
+		if el == elementNone || el != e.ctx.element || e.ctx.delim != delimNone || isInTag(e.ctx.state) {
+			return errorf(ErrHelperContext, "CloseTag called in %v, not in HTML text or a %s element", e.ctx.state, name)
+		}
+	}
+	return e.Literal("</" + name + ">")
+}
+
+// JSONLD writes a script element with structured data, encoded as JSON:
+//
+//	<script type="application/ld+json">{...}</script>
+//
+// The characters '<', '>', and '&', and the line and paragraph separators
+// U+2028 and U+2029, are written as \u escapes, so the data can't end the
+// script element early, even if it contains "</script>". If v can't be
+// encoded as JSON, nothing is written, and an ErrJSON error is returned.
+func (e *Escaper) JSONLD(v interface{}) error {
+	if err := e.requireText("JSONLD"); err != nil {
+		return err
+	}
+	data, err := jsonScriptEscaper(v)
+	if err != nil {
+		return err
+	}
+	if err := e.startScript("application/ld+json", nil); err != nil {
+		return err
+	}
+	return e.Literal(data + "</script>")
+}
+
+// openGraphURLProps lists the Open Graph properties whose values are URLs.
+var openGraphURLProps = map[string]bool{
+	"og:audio":            true,
+	"og:audio:secure_url": true,
+	"og:audio:url":        true,
+	"og:image":            true,
+	"og:image:secure_url": true,
+	"og:image:url":        true,
+	"og:url":              true,
+	"og:video":            true,
+	"og:video:secure_url": true,
+	"og:video:url":        true,
+}
+
+// OpenGraph writes a meta element for each Open Graph property in props,
+// in order by property name:
+//
+//	<meta property="og:title" content="...">
+//
+// The keys are complete property names, such as "og:title". Values of
+// properties that are URLs, such as "og:image", are checked with e's URL
+// policy, the same way as URLs in href attributes.
+func (e *Escaper) OpenGraph(props map[string]string) error {
+	if err := e.requireText("OpenGraph"); err != nil {
+		return err
+	}
+	names := make([]string, 0, len(props))
+	for name := range props {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	policy := e.urlPolicy()
+	if policy == nil {
+		policy = DefaultURLPolicy
+	}
+	for _, name := range names {
+		content := props[name]
+		if openGraphURLProps[strings.ToLower(name)] {
+			if u, ok := policy(content, URLContext{Element: "meta", Attr: "content"}); ok {
+				content = urlNormalizer(u)
+			} else {
+				content = e.failsafeFor("#" + filterFailsafe)
+			}
+		}
+		if err := e.Print(`<meta property="`, name, `" content="`, content, `">`); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// inputTimeLayouts maps input types to the layouts used for their values.
+var inputTimeLayouts = map[string]string{
+	"date":           "2006-01-02",
+	"datetime-local": "2006-01-02T15:04:05",
+	"month":          "2006-01",
+	"time":           "15:04:05",
+}
+
+// formatInputValue formats v for the value attribute of an input element of
+// type inputType.
+func formatInputValue(inputType string, v interface{}) interface{} {
+	switch v := indirect(v).(type) {
+	case time.Time:
+		if inputType == "week" {
+			year, week := v.ISOWeek()
+			return fmt.Sprintf("%04d-W%02d", year, week)
+		}
+		if layout, ok := inputTimeLayouts[inputType]; ok {
+			if v.Second() == 0 && v.Nanosecond() == 0 {
+				// Omit the seconds, which are optional.
+				layout = strings.TrimSuffix(layout, ":05")
+			}
+			return v.Format(layout)
+		}
+		return v.Format(time.RFC3339)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case float32:
+		return strconv.FormatFloat(float64(v), 'f', -1, 32)
+	}
+	return v
+}
+
+// InputValue writes the attribute that sets the value of an input element
+// of type inputType to v. It must be called inside the input element's start
+// tag.
+//
+// Values are formatted the way the input type expects them. For checkboxes
+// and radio buttons, a bool value writes a checked attribute if it is true,
+// and nothing if it is false. A time.Time is formatted as YYYY-MM-DD for a
+// date input, and similarly for datetime-local, month, week, and time
+// inputs. Floating-point numbers are written without exponents.
+func (e *Escaper) InputValue(inputType string, v interface{}) error {
+	if err := e.requireStartTag("InputValue"); err != nil {
+		return err
+	}
+	inputType = strings.ToLower(inputType)
+	if b, ok := indirect(v).(bool); ok && (inputType == "checkbox" || inputType == "radio") {
+		return e.BoolAttr("checked", b)
+	}
+	return e.Attr("value", formatInputValue(inputType, v))
+}
+
+// StyleMap writes a style attribute that sets the CSS properties in props,
+// in order by property name. It must be called inside a start tag. The
+// property names are escaped as CSS identifiers, and the values are filtered
+// like any other value in a style attribute.
+func (e *Escaper) StyleMap(props map[string]interface{}) error {
+	if err := e.requireStartTag("StyleMap"); err != nil {
+		return err
+	}
+	names := make([]string, 0, len(props))
+	for name := range props {
+		if name == "" {
+			return errorf(ErrBadArg, "empty CSS property name")
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	if err := e.Literal(` style="`); err != nil {
+		return err
+	}
+	for i, name := range names {
+		sep := ""
+		if i > 0 {
+			sep = "; "
+		}
+		if err := e.Literal(sep + cssIdentEscaper(name) + ": "); err != nil {
+			return err
+		}
+		if err := e.Value(props[name]); err != nil {
+			return err
+		}
+	}
+	return e.Literal(`"`)
+}
+
+// isMIMEType reports whether s looks like a MIME type or a similar token,
+// such as "module", that is safe to write in an attribute without escaping.
+func isMIMEType(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case asciiAlphaNum(c), c == '/', c == '-', c == '+', c == '.':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// Script writes a script element that loads the script at src:
+//
+//	<script type="module" src="..." nonce="..."></script>
+//
+// The type attribute is omitted if typ is empty. If typ is "module" and
+// e.ModulePreload is set, Script also writes a link that preloads the
+// module, ahead of the script element. The URL is filtered the same way in
+// both places.
+func (e *Escaper) Script(typ string, src interface{}) error {
+	if err := e.requireText("Script"); err != nil {
+		return err
+	}
+	if typ != "" && !isMIMEType(typ) {
+		return errorf(ErrBadArg, "invalid script type: %q", typ)
+	}
+	if typ == "module" && e.ModulePreload {
+		if err := e.Literal(`<link rel="modulepreload" href="`); err != nil {
+			return err
+		}
+		if err := e.Value(src); err != nil {
+			return err
+		}
+		if err := e.Literal(`">`); err != nil {
+			return err
+		}
+	}
+	if err := e.startScript(typ, src); err != nil {
+		return err
+	}
+	return e.Literal("</script>")
+}
+
+// meta writes a meta element with the given name and content. name must be a
+// constant.
+func (e *Escaper) meta(helper, name string, content interface{}) error {
+	if err := e.requireText(helper); err != nil {
+		return err
+	}
+	return e.Print(`<meta name="`+name+`" content="`, content, `">`)
+}
+
+// Charset writes a meta element that declares the character encoding of the
+// page, which is always UTF-8:
+//
+//	<meta charset="utf-8">
+func (e *Escaper) Charset() error {
+	if err := e.requireText("Charset"); err != nil {
+		return err
+	}
+	return e.Literal(`<meta charset="utf-8">`)
+}
+
+// Viewport writes a meta element that sets the viewport, such as
+// "width=device-width, initial-scale=1".
+func (e *Escaper) Viewport(content string) error {
+	return e.meta("Viewport", "viewport", content)
+}
+
+// Robots writes a meta element with instructions for search engine crawlers,
+// such as "noindex, nofollow".
+func (e *Escaper) Robots(content string) error {
+	return e.meta("Robots", "robots", content)
+}
+
+// ThemeColor writes a meta element that sets the theme color of the page.
+// The color is filtered like a value in CSS, so a value that is not a
+// plausible color is replaced with "ZgotmplZ" (or the string set with
+// SetFailsafe).
+func (e *Escaper) ThemeColor(color string) error {
+	color = cssValueFilter(color)
+	if color == filterFailsafe {
+		color = e.failsafeFor(filterFailsafe)
+	}
+	return e.meta("ThemeColor", "theme-color", color)
+}
+
+// A MediaSource is an alternative source for an audio or video element.
+type MediaSource struct {
+	// URL is the URL of the media file.
+	URL string
+	// Type is the MIME type of the media file, optionally with codecs,
+	// such as `video/webm; codecs="vp8, vorbis"`. It may be empty.
+	Type string
+}
+
+// MediaAttrs holds the attributes for Media.
+type MediaAttrs struct {
+	// Src is the URL of the media file, for an element with no sources.
+	Src string
+	// Poster is the URL of an image to show before a video starts
+	// playing.
+	Poster string
+
+	Controls    bool
+	Autoplay    bool
+	Muted       bool
+	Loop        bool
+	PlaysInline bool
+}
+
+// Media writes an audio or video element (depending on tag), with a source
+// element for each item in sources. The URLs are filtered like other URLs,
+// and the types must be valid MIME types.
+func (e *Escaper) Media(tag string, sources []MediaSource, attrs MediaAttrs) error {
+	if err := e.requireText("Media"); err != nil {
+		return err
+	}
+	if tag != "audio" && tag != "video" {
+		return errorf(ErrBadArg, "invalid media element: %q", tag)
+	}
+	for _, s := range sources {
+		if s.Type == "" {
+			continue
+		}
+		if _, _, err := mime.ParseMediaType(s.Type); err != nil {
+			return errorf(ErrBadArg, "invalid media type %q: %v", s.Type, err)
+		}
+	}
+
+	if err := e.Literal("<" + tag); err != nil {
+		return err
+	}
+	if attrs.Src != "" {
+		if err := e.Attr("src", attrs.Src); err != nil {
+			return err
+		}
+	}
+	if attrs.Poster != "" && tag == "video" {
+		if err := e.Attr("poster", attrs.Poster); err != nil {
+			return err
+		}
+	}
+	for _, b := range []struct {
+		name string
+		set  bool
+	}{
+		{"controls", attrs.Controls},
+		{"autoplay", attrs.Autoplay},
+		{"muted", attrs.Muted},
+		{"loop", attrs.Loop},
+		{"playsinline", attrs.PlaysInline},
+	} {
+		if err := e.BoolAttr(b.name, b.set); err != nil {
+			return err
+		}
+	}
+	if err := e.Literal(">"); err != nil {
+		return err
+	}
+
+	for _, s := range sources {
+		if err := e.Print(`<source src="`, s.URL, `"`); err != nil {
+			return err
+		}
+		if s.Type != "" {
+			if err := e.Print(` type="`, s.Type, `"`); err != nil {
+				return err
+			}
+		}
+		if err := e.Literal(">"); err != nil {
+			return err
+		}
+	}
+	return e.Literal("</" + tag + ">")
+}
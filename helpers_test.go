@@ -0,0 +1,687 @@
+package escaper
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestOpenGraphURLPolicy(t *testing.T) {
+	props := map[string]string{
+		"og:title": "A <title>",
+		"og:image": "tel:123",
+		"og:url":   "javascript:alert(1)",
+	}
+	tests := []struct {
+		name  string
+		setup func(e *Escaper)
+		want  string
+	}{
+		{
+			"default",
+			nil,
+			`<meta property="og:image" content="#ZgotmplZ"><meta property="og:title" content="A &lt;title&gt;"><meta property="og:url" content="#ZgotmplZ">`,
+		},
+		{
+			"URLSchemes",
+			func(e *Escaper) { e.URLSchemes = []string{"tel"} },
+			`<meta property="og:image" content="tel:123"><meta property="og:title" content="A &lt;title&gt;"><meta property="og:url" content="#ZgotmplZ">`,
+		},
+		{
+			"URLPolicy",
+			func(e *Escaper) {
+				e.URLPolicy = func(url string, ctx URLContext) (string, bool) {
+					return url, ctx.Element == "meta" && ctx.Attr == "content" && strings.HasPrefix(url, "tel:")
+				}
+			},
+			`<meta property="og:image" content="tel:123"><meta property="og:title" content="A &lt;title&gt;"><meta property="og:url" content="#ZgotmplZ">`,
+		},
+		{
+			"failsafe",
+			func(e *Escaper) { e.SetFailsafe("about:invalid") },
+			`<meta property="og:image" content="about:invalid"><meta property="og:title" content="A &lt;title&gt;"><meta property="og:url" content="about:invalid">`,
+		},
+	}
+	for _, tt := range tests {
+		var b strings.Builder
+		e := New(&b)
+		if tt.setup != nil {
+			tt.setup(e)
+		}
+		if err := e.OpenGraph(props); err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if got := b.String(); got != tt.want {
+			t.Errorf("%s:\ngot  %q\nwant %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestConfigScript(t *testing.T) {
+	tests := []struct {
+		name     string
+		nonce    string
+		jsVar    string
+		v        interface{}
+		want     string
+		wantCode ErrorCode
+	}{
+		{
+			"map",
+			"",
+			"config",
+			map[string]interface{}{"a": 1},
+			`<script>window.config = {"a":1};</script>`,
+			OK,
+		},
+		{
+			"script breakout",
+			"",
+			"config",
+			map[string]string{"s": "</script><script>alert(1)"},
+			`<script>window.config = {"s":"\u003c/script\u003e\u003cscript\u003ealert(1)"};</script>`,
+			OK,
+		},
+		{
+			"nonce",
+			`abc"`,
+			"$cfg_1",
+			"x",
+			`<script nonce="abc&#34;">window.$cfg_1 = "x";</script>`,
+			OK,
+		},
+		{"statement", "", "config = evil(); x", nil, "", ErrBadArg},
+		{"leading digit", "", "1config", nil, "", ErrBadArg},
+		{"property", "", "a.b", nil, "", ErrBadArg},
+		{"empty", "", "", nil, "", ErrBadArg},
+	}
+	for _, tt := range tests {
+		var b strings.Builder
+		e := New(&b)
+		e.Nonce = tt.nonce
+		err := e.ConfigScript(tt.jsVar, tt.v)
+		if tt.wantCode != OK {
+			var ee *Error
+			if !errors.As(err, &ee) || ee.ErrorCode != tt.wantCode {
+				t.Errorf("%s: got error %v, want code %v", tt.name, err, tt.wantCode)
+			}
+			if b.Len() != 0 {
+				t.Errorf("%s: wrote %q with invalid identifier", tt.name, b.String())
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if got := b.String(); got != tt.want {
+			t.Errorf("%s:\ngot  %q\nwant %q", tt.name, got, tt.want)
+		}
+	}
+
+	var b strings.Builder
+	e := New(&b)
+	e.Literal(`<a title="`)
+	err := e.ConfigScript("config", 1)
+	var ee *Error
+	if !errors.As(err, &ee) || ee.ErrorCode != ErrHelperContext {
+		t.Errorf("in attribute: got error %v, want ErrHelperContext", err)
+	}
+}
+
+func TestAttrPreferUnquoted(t *testing.T) {
+	tests := []struct {
+		name, value string
+		want        string
+	}{
+		{"class", "btn", `<a class=btn>`},
+		{"title", "a b", `<a title="a b">`},
+		{"title", `a"b`, `<a title=a&#34;b>`},
+		{"title", "a'b", `<a title=a&#39;b>`},
+		{"title", "a=b", `<a title="a=b">`},
+		{"title", "a<b", `<a title=a&lt;b>`},
+		{"title", "a>b", `<a title=a&gt;b>`},
+		{"title", "a`b", "<a title=\"a`b\">"},
+		{"title", "a/", `<a title="a/">`},
+		{"title", "", `<a title="">`},
+		{"href", "a.html", `<a href=a.html>`},
+		{"href", "javascript:alert(1)", `<a href=#ZgotmplZ>`},
+	}
+	for _, tt := range tests {
+		var b strings.Builder
+		e := New(&b)
+		e.PreferUnquoted = true
+		e.Literal("<a")
+		if err := e.Attr(tt.name, tt.value); err != nil {
+			t.Errorf("Attr(%q, %q): %v", tt.name, tt.value, err)
+			continue
+		}
+		e.Literal(">")
+		if got := b.String(); got != tt.want {
+			t.Errorf("Attr(%q, %q): got %q, want %q", tt.name, tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestJSONLD(t *testing.T) {
+	type article struct {
+		Context  string `json:"@context"`
+		Type     string `json:"@type"`
+		Headline string `json:"headline"`
+	}
+	tests := []struct {
+		name  string
+		nonce string
+		v     interface{}
+		want  string
+	}{
+		{
+			"struct",
+			"",
+			article{"https://schema.org", "Article", "Hello"},
+			`<script type="application/ld+json">{"@context":"https://schema.org","@type":"Article","headline":"Hello"}</script>`,
+		},
+		{
+			"script breakout",
+			"",
+			article{"https://schema.org", "Article", "</script><script>alert(1)</script>"},
+			`<script type="application/ld+json">{"@context":"https://schema.org","@type":"Article","headline":"\u003c/script\u003e\u003cscript\u003ealert(1)\u003c/script\u003e"}</script>`,
+		},
+		{
+			"comment",
+			"",
+			map[string]string{"a": "<!--", "b": "-->"},
+			`<script type="application/ld+json">{"a":"\u003c!--","b":"--\u003e"}</script>`,
+		},
+		{
+			"line separators",
+			"",
+			"a\u2028b\u2029",
+			`<script type="application/ld+json">"a\u2028b\u2029"</script>`,
+		},
+		{
+			"nonce",
+			"abc",
+			1,
+			`<script type="application/ld+json" nonce="abc">1</script>`,
+		},
+	}
+	for _, tt := range tests {
+		var b strings.Builder
+		e := New(&b)
+		e.Nonce = tt.nonce
+		if err := e.JSONLD(tt.v); err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if got := b.String(); got != tt.want {
+			t.Errorf("%s:\ngot  %q\nwant %q", tt.name, got, tt.want)
+		}
+	}
+
+	e := New(io.Discard)
+	err := e.JSONLD(func() {})
+	var ee *Error
+	if !errors.As(err, &ee) || ee.ErrorCode != ErrJSON {
+		t.Errorf("unencodable value: got error %v, want ErrJSON", err)
+	}
+}
+
+func TestInputValue(t *testing.T) {
+	tm := time.Date(2024, 3, 5, 14, 7, 0, 0, time.UTC)
+	tmSec := time.Date(2024, 3, 5, 14, 7, 9, 0, time.UTC)
+	tests := []struct {
+		inputType string
+		v         interface{}
+		want      string
+	}{
+		{"date", tm, `<input value="2024-03-05">`},
+		{"DATE", &tm, `<input value="2024-03-05">`},
+		{"datetime-local", tm, `<input value="2024-03-05T14:07">`},
+		{"datetime-local", tmSec, `<input value="2024-03-05T14:07:09">`},
+		{"month", tm, `<input value="2024-03">`},
+		{"week", tm, `<input value="2024-W10">`},
+		{"time", tm, `<input value="14:07">`},
+		{"text", tm, `<input value="2024-03-05T14:07:00Z">`},
+		{"number", 1e21, `<input value="1000000000000000000000">`},
+		{"number", 0.000001, `<input value="0.000001">`},
+		{"number", float32(1.5), `<input value="1.5">`},
+		{"number", 42, `<input value="42">`},
+		{"checkbox", true, `<input checked>`},
+		{"checkbox", false, `<input>`},
+		{"radio", true, `<input checked>`},
+		{"text", true, `<input value="true">`},
+		{"text", `"><script>`, `<input value="&#34;&gt;&lt;script&gt;">`},
+	}
+	for _, tt := range tests {
+		var b strings.Builder
+		e := New(&b)
+		e.Literal("<input")
+		if err := e.InputValue(tt.inputType, tt.v); err != nil {
+			t.Errorf("InputValue(%q, %v): %v", tt.inputType, tt.v, err)
+			continue
+		}
+		e.Literal(">")
+		if got := b.String(); got != tt.want {
+			t.Errorf("InputValue(%q, %v): got %q, want %q", tt.inputType, tt.v, got, tt.want)
+		}
+	}
+}
+
+func TestScript(t *testing.T) {
+	tests := []struct {
+		name    string
+		preload bool
+		nonce   string
+		typ     string
+		src     interface{}
+		want    string
+	}{
+		{"classic", false, "", "", "/a.js", `<script src="/a.js"></script>`},
+		{"module", false, "", "module", "/a.js", `<script type="module" src="/a.js"></script>`},
+		{"preload", true, "", "module", "/a b.js", `<link rel="modulepreload" href="/a%20b.js"><script type="module" src="/a%20b.js"></script>`},
+		{"preload filtered", true, "", "module", "javascript:alert(1)", `<link rel="modulepreload" href="#ZgotmplZ"><script type="module" src="#ZgotmplZ"></script>`},
+		{"preload classic", true, "", "", "/a.js", `<script src="/a.js"></script>`},
+		{"nonce", true, "n", "module", "/a.js", `<link rel="modulepreload" href="/a.js"><script type="module" src="/a.js" nonce="n"></script>`},
+		{"List src", false, "", "", List{"x", `"></script><script>alert(1)</script>`}, `<script src="x%22%3E%3C/script%3E%3Cscript%3Ealert%281%29%3C/script%3E"></script>`},
+		{"List preload", true, "", "module", List{"x", `"><script>alert(1)</script>`}, `<link rel="modulepreload" href="x%22%3E%3Cscript%3Ealert%281%29%3C/script%3E"><script type="module" src="x%22%3E%3Cscript%3Ealert%281%29%3C/script%3E"></script>`},
+	}
+	for _, tt := range tests {
+		var b strings.Builder
+		e := New(&b)
+		e.ModulePreload = tt.preload
+		e.Nonce = tt.nonce
+		if err := e.Script(tt.typ, tt.src); err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if got := b.String(); got != tt.want {
+			t.Errorf("%s:\ngot  %q\nwant %q", tt.name, got, tt.want)
+		}
+	}
+
+	e := New(io.Discard)
+	if err := e.Script(`module" onload="x`, "/a.js"); err == nil {
+		t.Error("no error for invalid type")
+	}
+}
+
+func TestMetaHelpers(t *testing.T) {
+	tests := []struct {
+		name  string
+		write func(e *Escaper) error
+		want  string
+	}{
+		{"Charset", (*Escaper).Charset, `<meta charset="utf-8">`},
+		{"Viewport", func(e *Escaper) error { return e.Viewport("width=device-width, initial-scale=1") }, `<meta name="viewport" content="width=device-width, initial-scale=1">`},
+		{"Viewport breakout", func(e *Escaper) error { return e.Viewport(`x"><script>alert(1)</script>`) }, `<meta name="viewport" content="x&#34;&gt;&lt;script&gt;alert(1)&lt;/script&gt;">`},
+		{"Robots", func(e *Escaper) error { return e.Robots("noindex, nofollow") }, `<meta name="robots" content="noindex, nofollow">`},
+		{"ThemeColor", func(e *Escaper) error { return e.ThemeColor("#336699") }, `<meta name="theme-color" content="#336699">`},
+		{"ThemeColor name", func(e *Escaper) error { return e.ThemeColor("rebeccapurple") }, `<meta name="theme-color" content="rebeccapurple">`},
+		{"ThemeColor expression", func(e *Escaper) error { return e.ThemeColor("expression(alert(1))") }, `<meta name="theme-color" content="ZgotmplZ">`},
+		{"ThemeColor breakout", func(e *Escaper) error { return e.ThemeColor(`red"><script>`) }, `<meta name="theme-color" content="ZgotmplZ">`},
+		{"ThemeColor failsafe", func(e *Escaper) error { e.SetFailsafe(""); return e.ThemeColor("expression(alert(1))") }, `<meta name="theme-color" content="">`},
+		{"ThemeColor failsafe word", func(e *Escaper) error { e.SetFailsafe("unset"); return e.ThemeColor(`red"><script>`) }, `<meta name="theme-color" content="unset">`},
+	}
+	for _, tt := range tests {
+		var b strings.Builder
+		e := New(&b)
+		if err := tt.write(e); err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if got := b.String(); got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+
+	e := New(io.Discard)
+	e.Literal("<p ")
+	if err := e.Viewport("width=device-width"); err == nil {
+		t.Error("no error for Viewport inside a tag")
+	}
+}
+
+func TestMedia(t *testing.T) {
+	tests := []struct {
+		name    string
+		tag     string
+		sources []MediaSource
+		attrs   MediaAttrs
+		want    string
+		wantErr bool
+	}{
+		{
+			"video",
+			"video",
+			[]MediaSource{{"/a.webm", `video/webm; codecs="vp8, vorbis"`}, {"/a.mp4", "video/mp4"}},
+			MediaAttrs{Poster: "/a.jpg", Controls: true, Muted: true},
+			`<video poster="/a.jpg" controls muted><source src="/a.webm" type="video/webm; codecs=&#34;vp8, vorbis&#34;"><source src="/a.mp4" type="video/mp4"></video>`,
+			false,
+		},
+		{
+			"javascript source",
+			"video",
+			[]MediaSource{{"javascript:alert(1)", ""}, {"/a.mp4", ""}},
+			MediaAttrs{Autoplay: true, Loop: true, PlaysInline: true},
+			`<video autoplay loop playsinline><source src="#ZgotmplZ"><source src="/a.mp4"></video>`,
+			false,
+		},
+		{
+			"audio src",
+			"audio",
+			nil,
+			MediaAttrs{Src: "/a b.mp3", Poster: "/ignored.jpg", Controls: true},
+			`<audio src="/a%20b.mp3" controls></audio>`,
+			false,
+		},
+		{
+			"javascript poster",
+			"video",
+			nil,
+			MediaAttrs{Src: "javascript:x", Poster: "javascript:y"},
+			`<video src="#ZgotmplZ" poster="#ZgotmplZ"></video>`,
+			false,
+		},
+		{"bad tag", "img", nil, MediaAttrs{}, "", true},
+		{"bad type", "video", []MediaSource{{"/a.mp4", `video/mp4" onerror="x`}}, MediaAttrs{}, "", true},
+	}
+	for _, tt := range tests {
+		var b strings.Builder
+		e := New(&b)
+		err := e.Media(tt.tag, tt.sources, tt.attrs)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("%s: no error", tt.name)
+			}
+			if b.Len() != 0 {
+				t.Errorf("%s: wrote %q", tt.name, b.String())
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if got := b.String(); got != tt.want {
+			t.Errorf("%s:\ngot  %q\nwant %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestTagBuilder(t *testing.T) {
+	tests := []struct {
+		name    string
+		build   func(e *Escaper) error
+		want    string
+		wantErr error
+	}{
+		{
+			"link",
+			func(e *Escaper) error {
+				e.OpenTag("a")
+				e.Attr("href", "javascript:alert(1)")
+				e.Attr("title", `"x"`)
+				e.CloseStartTag()
+				e.Value("<b>")
+				return e.CloseTag("a")
+			},
+			`<a href="#ZgotmplZ" title="&#34;x&#34;">&lt;b&gt;</a>`,
+			nil,
+		},
+		{
+			"script",
+			func(e *Escaper) error {
+				e.OpenTag("script")
+				e.CloseStartTag()
+				e.Literal("var x = ")
+				e.Value("</script>")
+				return e.CloseTag("script")
+			},
+			`<script>var x = "\u003c/script\u003e"</script>`,
+			nil,
+		},
+		{
+			"JSON script",
+			func(e *Escaper) error {
+				e.Literal(`<script type="application/json">`)
+				e.Value(map[string]string{"a": "</script>"})
+				return e.CloseTag("script")
+			},
+			`<script type="application/json">{"a":"\u003c/script\u003e"}</script>`,
+			nil,
+		},
+		{
+			"custom element",
+			func(e *Escaper) error {
+				e.OpenTag("my-element")
+				e.Attr("data-x", 1)
+				e.CloseStartTag()
+				return e.CloseTag("my-element")
+			},
+			`<my-element data-x="1"></my-element>`,
+			nil,
+		},
+		{
+			"after unquoted value",
+			func(e *Escaper) error {
+				e.Literal("<a class=x")
+				e.Attr("id", "y")
+				return e.CloseStartTag()
+			},
+			`<a class=x id="y">`,
+			nil,
+		},
+		{
+			"invalid tag name",
+			func(e *Escaper) error { return e.OpenTag("a onclick=x") },
+			"",
+			ErrBadArg,
+		},
+		{
+			"invalid attribute name",
+			func(e *Escaper) error {
+				e.OpenTag("a")
+				return e.Attr("x=1 onclick", "y")
+			},
+			"<a",
+			ErrBadArg,
+		},
+		{
+			"OpenTag in tag",
+			func(e *Escaper) error {
+				e.OpenTag("a")
+				return e.OpenTag("b")
+			},
+			"<a",
+			ErrHelperContext,
+		},
+		{
+			"OpenTag in attribute",
+			func(e *Escaper) error {
+				e.Literal(`<a title="`)
+				return e.OpenTag("b")
+			},
+			`<a title="`,
+			ErrHelperContext,
+		},
+		{
+			"Attr in text",
+			func(e *Escaper) error { return e.Attr("id", "x") },
+			"",
+			ErrHelperContext,
+		},
+		{
+			"Attr in quoted value",
+			func(e *Escaper) error {
+				e.Literal(`<a title="x`)
+				return e.Attr("id", "y")
+			},
+			`<a title="x`,
+			ErrHelperContext,
+		},
+		{
+			"CloseStartTag in text",
+			func(e *Escaper) error { return e.CloseStartTag() },
+			"",
+			ErrHelperContext,
+		},
+		{
+			"CloseTag in tag",
+			func(e *Escaper) error {
+				e.OpenTag("a")
+				return e.CloseTag("a")
+			},
+			"<a",
+			ErrHelperContext,
+		},
+		{
+			"CloseTag for other element in script",
+			func(e *Escaper) error {
+				e.Literal("<script>")
+				return e.CloseTag("style")
+			},
+			"<script>",
+			ErrHelperContext,
+		},
+		{
+			"CloseTag in attribute",
+			func(e *Escaper) error {
+				e.Literal(`<a title="`)
+				return e.CloseTag("a")
+			},
+			`<a title="`,
+			ErrHelperContext,
+		},
+	}
+	for _, tt := range tests {
+		var b strings.Builder
+		err := tt.build(New(&b))
+		if !errors.Is(err, tt.wantErr) || (err != nil) != (tt.wantErr != nil) {
+			t.Errorf("%s: got error %v, want %v", tt.name, err, tt.wantErr)
+		}
+		if got := b.String(); got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestAttrEscaping(t *testing.T) {
+	tests := []struct {
+		tag, name string
+		value     interface{}
+		want      string
+	}{
+		{"a", "href", "javascript:alert(1)", `<a href="#ZgotmplZ">`},
+		{"a", "href", "/a b?c=d&e", `<a href="/a%20b?c=d&amp;e">`},
+		{"img", "src", "/a.png", `<img src="/a.png">`},
+		{"img", "srcset", "/a.png 1x, javascript:x 2x", `<img srcset="/a.png 1x, #ZgotmplZ">`},
+		{"a", "onclick", "x'y", `<a onclick="&#34;x&#39;y&#34;">`},
+		{"a", "style", "color: red", `<a style="color: red">`},
+		{"a", "style", "color: red; background: url(x)", `<a style="ZgotmplZ">`},
+		{"a", "title", `"><script>`, `<a title="&#34;&gt;&lt;script&gt;">`},
+		{"a", "data-url", "javascript:x", `<a data-url="#ZgotmplZ">`},
+		{"a", "xlink:href", "javascript:x", `<a xlink:href="#ZgotmplZ">`},
+		{"a", "HREF", "javascript:x", `<a HREF="#ZgotmplZ">`},
+		{"a", "id", 42, `<a id="42">`},
+	}
+	for _, tt := range tests {
+		var b strings.Builder
+		e := New(&b)
+		e.Literal("<" + tt.tag)
+		if err := e.Attr(tt.name, tt.value); err != nil {
+			t.Errorf("%s=%v: %v", tt.name, tt.value, err)
+			continue
+		}
+		e.Literal(">")
+		if got := b.String(); got != tt.want {
+			t.Errorf("%s=%v: got %q, want %q", tt.name, tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestBoolAttr(t *testing.T) {
+	tests := []struct {
+		name    string
+		attr    string
+		present bool
+		xml     bool
+		want    string
+		wantErr error
+	}{
+		{"present", "disabled", true, false, "<input disabled>", nil},
+		{"absent", "disabled", false, false, "<input>", nil},
+		{"XML", "checked", true, true, `<input checked="checked"/>`, nil},
+		{"invalid name", "x onclick", true, false, "<input>", ErrBadArg},
+		{"invalid name absent", "x onclick", false, false, "<input>", ErrBadArg},
+		{"event handler", "onclick", true, false, "<input>", ErrBadArg},
+		{"URL attribute", "href", true, false, "<input>", ErrBadArg},
+		{"style", "style", true, false, "<input>", ErrBadArg},
+	}
+	for _, tt := range tests {
+		var b strings.Builder
+		e := New(&b)
+		e.XML = tt.xml
+		e.Literal("<input")
+		err := e.BoolAttr(tt.attr, tt.present)
+		if !errors.Is(err, tt.wantErr) || (err != nil) != (tt.wantErr != nil) {
+			t.Errorf("%s: got error %v, want %v", tt.name, err, tt.wantErr)
+		}
+		e.Literal(">")
+		if got := b.String(); got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+
+	e := New(io.Discard)
+	if err := e.BoolAttr("disabled", true); !errors.Is(err, ErrHelperContext) {
+		t.Errorf("in text: got %v, want ErrHelperContext", err)
+	}
+}
+
+func TestOmitEmptyAttrs(t *testing.T) {
+	empty, title := "", "x"
+	var nilString *string
+	tests := []struct {
+		name  string
+		value interface{}
+		want  string
+	}{
+		{"nil", nil, "<p>"},
+		{"empty string", "", "<p>"},
+		{"nil pointer", nilString, "<p>"},
+		{"pointer to empty string", &empty, "<p>"},
+		{"empty list", List{}, "<p>"},
+		{"empty List element", List{""}, "<p>"},
+		{"string", "x", `<p title="x">`},
+		{"pointer", &title, `<p title="x">`},
+		{"zero", 0, `<p title="0">`},
+		{"space", " ", `<p title=" ">`},
+	}
+	for _, tt := range tests {
+		var b strings.Builder
+		e := New(&b)
+		e.OmitEmptyAttrs = true
+		e.Literal("<p")
+		if err := e.Attr("title", tt.value); err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		e.Literal(">")
+		if got := b.String(); got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+
+	var b strings.Builder
+	e := New(&b)
+	e.Literal("<p")
+	e.Attr("title", "")
+	e.Literal(">")
+	if got, want := b.String(), `<p title="">`; got != want {
+		t.Errorf("without OmitEmptyAttrs: got %q, want %q", got, want)
+	}
+}
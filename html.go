@@ -38,6 +38,20 @@ func rcdataEscaper(args ...interface{}) string {
 	return htmlReplacer(s, htmlReplacementTable, true)
 }
 
+// cdataReplacer writes ']' and '>' as character references between two
+// CDATA sections.
+var cdataReplacer = strings.NewReplacer("]", "]]>&#93;<![CDATA[", ">", "]]>&gt;<![CDATA[")
+
+// cdataEscaper escapes for inclusion in a CDATA section in foreign content.
+// Character references are not decoded inside a CDATA section, and there is
+// no way to escape "]]>" there, so the section is closed and reopened around
+// each ']' and '>'. This keeps a value from ending the section, even together
+// with the text before or after it.
+func cdataEscaper(args ...interface{}) string {
+	s, _ := stringify(args...)
+	return cdataReplacer.Replace(s)
+}
+
 // htmlEscaper escapes for inclusion in HTML text.
 func htmlEscaper(args ...interface{}) string {
 	s, t := stringify(args...)
@@ -49,6 +63,9 @@ func htmlEscaper(args ...interface{}) string {
 
 // htmlReplacementTable contains the runes that need to be escaped
 // inside a quoted attribute value or in a text node.
+// '=' and '/' are not escaped, and '+' is written as "&#43;", which the HTML
+// parser decodes back to '+', so base64 data such as the hashes in integrity
+// attributes come through intact.
 var htmlReplacementTable = []string{
 	// http://www.w3.org/TR/html5/syntax.html#attribute-value-(unquoted)-state
 	// U+0000 NULL Parse error. Append a U+FFFD REPLACEMENT
@@ -83,12 +100,14 @@ var htmlNormReplacementTable = []string{
 // <div id=d></div>
 // <script>(function () {
 // var a = [], d = document.getElementById("d"), i, c, s;
-// for (i = 0; i < 0x10000; ++i) {
-//   c = String.fromCharCode(i);
-//   d.innerHTML = "<span title=" + c + "lt" + c + "></span>"
-//   s = d.getElementsByTagName("SPAN")[0];
-//   if (!s || s.title !== c + "lt" + c) { a.push(i.toString(16)); }
-// }
+//
+//	for (i = 0; i < 0x10000; ++i) {
+//	  c = String.fromCharCode(i);
+//	  d.innerHTML = "<span title=" + c + "lt" + c + "></span>"
+//	  s = d.getElementsByTagName("SPAN")[0];
+//	  if (!s || s.title !== c + "lt" + c) { a.push(i.toString(16)); }
+//	}
+//
 // document.write(a.join(", "));
 // })()</script>
 var htmlNospaceReplacementTable = []string{
@@ -103,9 +122,12 @@ var htmlNospaceReplacementTable = []string{
 	'&':  "&amp;",
 	'\'': "&#39;",
 	'+':  "&#43;",
-	'<':  "&lt;",
-	'=':  "&#61;",
-	'>':  "&gt;",
+	// A slash at the end of an unquoted value, just before the '>',
+	// would look like a self-closing tag to XML-based tools.
+	'/': "&#47;",
+	'<': "&lt;",
+	'=': "&#61;",
+	'>': "&gt;",
 	// A parse error in the attribute value (unquoted) and
 	// before attribute value states.
 	// Treated as a quoting character by IE.
@@ -125,9 +147,12 @@ var htmlNospaceNormReplacementTable = []string{
 	'"':  "&#34;",
 	'\'': "&#39;",
 	'+':  "&#43;",
-	'<':  "&lt;",
-	'=':  "&#61;",
-	'>':  "&gt;",
+	// A slash at the end of an unquoted value, just before the '>',
+	// would look like a self-closing tag to XML-based tools.
+	'/': "&#47;",
+	'<': "&lt;",
+	'=': "&#61;",
+	'>': "&gt;",
 	// A parse error in the attribute value (unquoted) and
 	// before attribute value states.
 	// Treated as a quoting character by IE.
@@ -249,6 +274,27 @@ func htmlNameFilter(args ...interface{}) string {
 	return s
 }
 
+// tagNameFilter returns filterFailsafe regardless of input.
+// The element type determines how the rest of the document is parsed (a
+// value of "script" would turn the following text into JavaScript), so
+// tag names are not allowed to come from values.
+func tagNameFilter(args ...interface{}) string {
+	return filterFailsafe
+}
+
+// canStartTag reports whether s, written after "<", would make it the start
+// of a tag, an end tag, a comment, or something else that isn't text.
+func canStartTag(s string) bool {
+	if s == "" {
+		return false
+	}
+	switch c := s[0]; {
+	case asciiAlpha(c), c == '/', c == '!', c == '?':
+		return true
+	}
+	return false
+}
+
 // commentEscaper returns the empty string regardless of input.
 // Comment content does not correspond to any parsed structure or
 // human-readable content, so the simplest and most secure policy is to drop
@@ -258,3 +304,28 @@ func htmlNameFilter(args ...interface{}) string {
 func commentEscaper(args ...interface{}) string {
 	return ""
 }
+
+// A CommentPolicy selects what an Escaper does with values that are written
+// inside a comment.
+type CommentPolicy int
+
+const (
+	// DropCommentValues makes the Escaper drop values in comments,
+	// writing nothing in their place. This is the default.
+	DropCommentValues CommentPolicy = iota
+
+	// RejectCommentValues makes a value in a comment an error, with the
+	// code ErrCommentValue, which is handled according to the
+	// ErrorPolicy.
+	RejectCommentValues
+
+	// EscapeCommentValues makes the Escaper escape values in HTML comments
+	// as HTML text and write them, for conditional comments, whose content
+	// is shown by some browsers, as in
+	//
+	//	<!--[if IE]><p>{{.}}</p><![endif]-->
+	//
+	// The escaping keeps a value from ending the comment. Values in
+	// comments in scripts and style sheets are still dropped.
+	EscapeCommentValues
+)
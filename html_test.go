@@ -0,0 +1,33 @@
+package escaper
+
+import "testing"
+
+func TestHTMLNospaceEscaper(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"abc", "abc"},
+		{"a/", "a&#47;"},
+		{"/a/b/", "&#47;a&#47;b&#47;"},
+		{"a b", "a&#32;b"},
+		{`a"b'c`, "a&#34;b&#39;c"},
+		{"a=b", "a&#61;b"},
+		{"a<b>", "a&lt;b&gt;"},
+		{"a`b", "a&#96;b"},
+	}
+	for _, tt := range tests {
+		if got := htmlNospaceEscaper(tt.in); got != tt.want {
+			t.Errorf("htmlNospaceEscaper(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestUnquotedSlash(t *testing.T) {
+	runValueTests(t, nil, []valueTest{
+		{"trailing slash", `<img alt=x`, `>`, "a/", `<img alt=xa&#47;>`},
+		{"only slash", `<img alt=x`, `>`, "/", `<img alt=x&#47;>`},
+		{"slash and tag end", `<img alt=x`, `>`, "/>", `<img alt=x&#47;&gt;>`},
+		{"quoted", `<img alt="`, `">`, "a/", `<img alt="a/">`},
+		{"auto-quoted", `<img alt=`, `>`, "a/", `<img alt="a/">`},
+	})
+}
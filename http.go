@@ -1,8 +1,14 @@
 package escaper
 
 import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/base64"
 	"io"
 	"net/http"
+	"strconv"
+	"strings"
 
 	"github.com/andybalholm/brotli"
 )
@@ -11,8 +17,538 @@ import (
 // as specified in the Accept-Encoding header, and sets the Content-Type and
 // Content-Encoding headers appropriately. The returned Closer must be closed
 // before the HTTP handler returns.
-func ForHTTP(w http.ResponseWriter, r *http.Request) (*Escaper, io.Closer) {
-	w.Header().Set("Content-Type", "text/html; charset=utf-8")
-	c := brotli.HTTPCompressor(w, r)
-	return New(c), c
+//
+// The Escaper's Flush method flushes both the compressor and the
+// ResponseWriter, so that the page can be sent to the browser in pieces.
+func ForHTTP(w http.ResponseWriter, r *http.Request, options ...HTTPOption) (*Escaper, io.Closer) {
+	conf := httpConfig{contentType: "text/html; charset=utf-8"}
+	for _, o := range options {
+		o(&conf)
+	}
+
+	if len(conf.earlyHints) > 0 {
+		for _, link := range conf.earlyHints {
+			w.Header().Add("Link", link)
+		}
+		w.WriteHeader(http.StatusEarlyHints)
+	}
+	w.Header().Set("Content-Type", conf.contentType)
+	if conf.disposition != "" {
+		w.Header().Set("Content-Disposition", conf.disposition)
+	}
+	hw := &httpWriter{rw: w, conf: conf}
+	if conf.etag && (r.Method == "GET" || r.Method == "HEAD") {
+		hw.ifNoneMatch = r.Header.Get("If-None-Match")
+	}
+	if !conf.noCompression {
+		if w.Header().Get("Vary") == "" {
+			w.Header().Set("Vary", "Accept-Encoding")
+		}
+		offers := []string{"br"}
+		for _, ce := range conf.encoders {
+			offers = append(offers, ce.name)
+		}
+		hw.encoding = negotiateEncoding(r.Header["Accept-Encoding"], append(offers, "gzip")...)
+	}
+	hw.e = New(hw)
+	return hw.e, hw
+}
+
+// An httpWriter is the Writer for an Escaper from ForHTTP.
+type httpWriter struct {
+	// WriteCloser is the compressor, or the ResponseWriter wrapped in a
+	// nopCloser. It is nil until the response starts, when something is
+	// written to it (or after the start of the response has been held
+	// back).
+	io.WriteCloser
+	rw   http.ResponseWriter
+	conf httpConfig
+	e    *Escaper
+
+	// encoding is the negotiated Content-Encoding.
+	encoding string
+	// buf holds the start of the response while it is shorter than
+	// conf.minSize, or the whole response if h.buffering().
+	buf []byte
+	// ifNoneMatch is the request's If-None-Match header, for a GET or
+	// HEAD request.
+	ifNoneMatch string
+	// status is the status code set with Escaper.Status, or 0.
+	status int
+}
+
+// holdSize returns the size that the response is held back until.
+func (h *httpWriter) holdSize() int {
+	if h.conf.deferSize > h.conf.minSize {
+		return h.conf.deferSize
+	}
+	return h.conf.minSize
+}
+
+// writeStatus sends the headers, with the status code set with
+// Escaper.Status, if any.
+func (h *httpWriter) writeStatus() {
+	if h.status != 0 {
+		h.rw.WriteHeader(h.status)
+	}
+}
+
+// buffering reports whether h holds the whole response until it is closed.
+func (h *httpWriter) buffering() bool {
+	return h.conf.etag || h.conf.buffered
+}
+
+// start starts the response with the given content encoding, setting up
+// h.WriteCloser to write to w.
+func (h *httpWriter) start(w io.Writer, encoding string) {
+	if encoding != "" {
+		h.rw.Header().Set("Content-Encoding", encoding)
+	}
+	switch encoding {
+	case "br":
+		h.WriteCloser = brotli.NewWriterOptions(w, h.conf.brotliOptions())
+	case "gzip":
+		// NewWriterLevel only fails with an invalid level.
+		h.WriteCloser, _ = gzip.NewWriterLevel(w, h.conf.gzipLevel())
+	case "":
+		h.WriteCloser = nopCloser{w}
+	default:
+		h.WriteCloser = h.conf.encoder(encoding)(w, h.conf.level, h.conf.lowMemory)
+	}
+}
+
+// startBuffered starts the response, and writes the buffered output.
+func (h *httpWriter) startBuffered(encoding string) error {
+	h.start(h.rw, encoding)
+	h.writeStatus()
+	buf := h.buf
+	h.buf = nil
+	if len(buf) == 0 {
+		return nil
+	}
+	_, err := h.WriteCloser.Write(buf)
+	return err
+}
+
+func (h *httpWriter) Write(p []byte) (n int, err error) {
+	if h.WriteCloser == nil {
+		if h.buffering() || len(h.buf)+len(p) < h.holdSize() {
+			h.buf = append(h.buf, p...)
+			return len(p), nil
+		}
+		if err := h.startBuffered(h.encoding); err != nil {
+			return 0, err
+		}
+	}
+	return h.WriteCloser.Write(p)
+}
+
+// Flush flushes the compressor and the ResponseWriter. If the response
+// hasn't started yet because it is shorter than the MinCompressSize or the
+// DeferHeaders size, it starts it, with compression. If the whole response
+// is being buffered, it does nothing.
+func (h *httpWriter) Flush() error {
+	if h.buffering() && h.WriteCloser == nil {
+		return nil
+	}
+	if h.WriteCloser == nil {
+		if err := h.startBuffered(h.encoding); err != nil {
+			return err
+		}
+	}
+	if f, ok := h.WriteCloser.(interface{ Flush() error }); ok {
+		if err := f.Flush(); err != nil {
+			return err
+		}
+	}
+	if f, ok := h.rw.(http.Flusher); ok {
+		f.Flush()
+	}
+	return nil
+}
+
+// Close finishes the response. A response that is shorter than the
+// MinCompressSize is written without compression.
+func (h *httpWriter) Close() error {
+	if h.WriteCloser != nil {
+		return h.WriteCloser.Close()
+	}
+	if h.buffering() {
+		return h.closeBuffered()
+	}
+	encoding := h.encoding
+	if len(h.buf) < h.conf.minSize {
+		encoding = ""
+	}
+	if err := h.startBuffered(encoding); err != nil {
+		return err
+	}
+	return h.WriteCloser.Close()
+}
+
+// closeBuffered writes a response that has been held in h.buf, with a
+// Content-Length header. If the Escaper has had an escaping error, it sends an
+// error response instead, and returns the escaping error.
+func (h *httpWriter) closeBuffered() error {
+	body := h.buf
+	h.buf = nil
+	// Further calls to Close do nothing.
+	h.WriteCloser = nopCloser{h.rw}
+	if h.e.ctx.state == stateError {
+		h.rw.Header().Del("Content-Disposition")
+		h.rw.Header().Del("ETag")
+		http.Error(h.rw, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return h.e.ctx.err
+	}
+	if h.conf.etag {
+		etag := bodyETag(body)
+		h.rw.Header().Set("ETag", etag)
+		if etagMatches(h.ifNoneMatch, etag) {
+			h.rw.WriteHeader(http.StatusNotModified)
+			return nil
+		}
+	}
+
+	encoding := h.encoding
+	if len(body) < h.conf.minSize {
+		encoding = ""
+	}
+	var b bytes.Buffer
+	h.start(&b, encoding)
+	if _, err := h.WriteCloser.Write(body); err != nil {
+		return err
+	}
+	if err := h.WriteCloser.Close(); err != nil {
+		return err
+	}
+	h.WriteCloser = nopCloser{h.rw}
+	h.rw.Header().Set("Content-Length", strconv.Itoa(b.Len()))
+	h.writeStatus()
+	_, err := h.rw.Write(b.Bytes())
+	return err
+}
+
+// bodyETag returns a weak entity tag for a response body. It is weak because
+// the compressed body is different for each content encoding.
+func bodyETag(body []byte) string {
+	sum := sha256.Sum256(body)
+	return `W/"` + base64.RawURLEncoding.EncodeToString(sum[:16]) + `"`
+}
+
+// etagMatches reports whether an If-None-Match header matches etag, using
+// the weak comparison from RFC 7232, section 2.3.2.
+func etagMatches(ifNoneMatch, etag string) bool {
+	if ifNoneMatch == "" {
+		return false
+	}
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, t := range strings.Split(ifNoneMatch, ",") {
+		t = strings.TrimSpace(t)
+		if t == "*" || strings.TrimPrefix(t, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// An HTTPOption changes how ForHTTP sets up the response.
+type HTTPOption func(*httpConfig)
+
+type httpConfig struct {
+	lowMemory     bool
+	disposition   string
+	contentType   string
+	noCompression bool
+	level         int
+	minSize       int
+	etag          bool
+	buffered      bool
+	earlyHints    []string
+	deferSize     int
+	errorPage     func(e *Escaper, v interface{})
+	encoders      []contentEncoder
+}
+
+// ETag makes ForHTTP hold the whole response until the Closer is closed, as
+// with Buffered, and then set an ETag header based on a hash of the page. If
+// the ETag matches the request's If-None-Match header, the response is
+// replaced by a 304 Not Modified status with no body.
+func ETag() HTTPOption {
+	return func(c *httpConfig) {
+		c.etag = true
+	}
+}
+
+// DeferHeaders makes ForHTTP hold the start of the response until it is n
+// bytes long, or the Escaper is flushed, before sending the status and
+// headers. Until then, the handler can still change the status code with
+// Escaper.Status, or replace the page with Escaper.Discard, for example to
+// show an error page if rendering fails early.
+func DeferHeaders(n int) HTTPOption {
+	return func(c *httpConfig) {
+		c.deferSize = n
+	}
+}
+
+// Status sets the status code of the response, for an Escaper from ForHTTP.
+// It must be called before the response has started: before anything is
+// written, or while the start of the response is being held back because of
+// DeferHeaders, Buffered, ETag, or MinCompressSize.
+func (e *Escaper) Status(code int) error {
+	h, ok := e.w.(*httpWriter)
+	if !ok {
+		return errorf(ErrHeadersSent, "Status called on an Escaper that is not from ForHTTP")
+	}
+	if h.WriteCloser != nil {
+		return errorf(ErrHeadersSent, "Status called after the response has started")
+	}
+	h.status = code
+	return nil
+}
+
+// Discard throws away the output of an Escaper from ForHTTP that hasn't been
+// sent yet, and resets the Escaper to the start of a page, so that a
+// different page (such as an error page) can be written instead. Like
+// Status, it must be called before the response has started.
+func (e *Escaper) Discard() error {
+	h, ok := e.w.(*httpWriter)
+	if !ok {
+		return errorf(ErrHeadersSent, "Discard called on an Escaper that is not from ForHTTP")
+	}
+	if h.WriteCloser != nil {
+		return errorf(ErrHeadersSent, "Discard called after the response has started")
+	}
+	h.buf = nil
+	e.Reset(h)
+	return nil
+}
+
+// Buffered makes ForHTTP hold the whole response until the Closer is closed,
+// and then send it with a Content-Length header, for clients and proxies that
+// don't handle chunked responses well. It also makes it possible to replace a
+// page that fails to render: if the Escaper has had an escaping error (see
+// ErrorPolicy) when the Closer is closed, the page is discarded, a 500
+// Internal Server Error response is sent instead, and Close returns the
+// escaping error.
+func Buffered() HTTPOption {
+	return func(c *httpConfig) {
+		c.buffered = true
+	}
+}
+
+// EarlyHints makes ForHTTP send a 103 Early Hints response with a Link header
+// for each item in links, so that the browser can start loading critical
+// resources while the page is being generated. For example:
+//
+//	EarlyHints("</style.css>; rel=preload; as=style")
+//
+// The Link headers are also included in the final response.
+func EarlyHints(links ...string) HTTPOption {
+	return func(c *httpConfig) {
+		c.earlyHints = append(c.earlyHints, links...)
+	}
+}
+
+// NoCompression turns off compression, for responses that are compressed
+// by a proxy or middleware instead.
+func NoCompression() HTTPOption {
+	return func(c *httpConfig) {
+		c.noCompression = true
+	}
+}
+
+// CompressionLevel sets the compression level, from 1 (fastest) to 9 (best
+// compression), on the same scale as gzip. For brotli, it is converted to the
+// nearest equivalent setting.
+func CompressionLevel(level int) HTTPOption {
+	return func(c *httpConfig) {
+		switch {
+		case level < 1:
+			level = 1
+		case level > 9:
+			level = 9
+		}
+		c.level = level
+	}
+}
+
+// MinCompressSize makes responses that are shorter than n bytes be sent
+// without compression, since compressing them would save little or nothing.
+// The response is held back until it reaches n bytes, the Escaper is
+// flushed, or the Closer is closed.
+func MinCompressSize(n int) HTTPOption {
+	return func(c *httpConfig) {
+		c.minSize = n
+	}
+}
+
+// ContentType sets the Content-Type header, instead of
+// "text/html; charset=utf-8". It is useful for responses such as SVG images
+// or XHTML documents.
+func ContentType(contentType string) HTTPOption {
+	return func(c *httpConfig) {
+		c.contentType = contentType
+	}
+}
+
+// Brotli settings for LowMemory.
+const (
+	lowMemoryQuality = 4
+	lowMemoryLGWin   = 16
+)
+
+// LowMemory limits the memory used for brotli compression, for servers that
+// run with little memory and handle many responses at once. It caps the
+// compression quality at 4 and the window size at 64 KB (instead of 4 MB).
+// Responses will be somewhat larger, especially large pages with content that
+// repeats at a distance, but each response uses much less memory while it is
+// being compressed.
+func LowMemory() HTTPOption {
+	return func(c *httpConfig) {
+		c.lowMemory = true
+	}
+}
+
+// ContentDisposition sets the Content-Disposition header, for pages that are
+// meant to be downloaded or saved. disposition is usually "inline" or
+// "attachment". If filename is not empty, it is included both as an ASCII
+// approximation and, percent-encoded as specified in RFC 5987, as UTF-8:
+//
+//	attachment; filename="Report _.html"; filename*=UTF-8''Report%20%C3%A9.html
+func ContentDisposition(disposition, filename string) HTTPOption {
+	return func(c *httpConfig) {
+		c.disposition = contentDisposition(disposition, filename)
+	}
+}
+
+// contentDisposition formats a Content-Disposition header value.
+func contentDisposition(disposition, filename string) string {
+	if filename == "" {
+		return disposition
+	}
+	ascii := strings.Map(func(r rune) rune {
+		if r < ' ' || r > '~' || r == '"' || r == '\\' {
+			return '_'
+		}
+		return r
+	}, filename)
+	return disposition + `; filename="` + ascii + `"; filename*=UTF-8''` + urlEscaper(filename)
+}
+
+// brotliOptions returns the options for the brotli Writer.
+func (c *httpConfig) brotliOptions() brotli.WriterOptions {
+	o := brotli.WriterOptions{Quality: brotli.DefaultCompression}
+	if c.level != 0 {
+		o.Quality = (c.level*brotli.BestCompression + 4) / 9
+	}
+	if c.lowMemory {
+		if o.Quality > lowMemoryQuality {
+			o.Quality = lowMemoryQuality
+		}
+		o.LGWin = lowMemoryLGWin
+	}
+	return o
+}
+
+// An Encoder returns a Writer that compresses what is written to it and
+// writes the result to w, for a content encoding added with ContentEncoding.
+// level is the level set with CompressionLevel, or 0 for the default, and
+// lowMemory reports whether LowMemory was used. If the Writer has a
+// Flush() error method, Escaper.Flush calls it.
+type Encoder func(w io.Writer, level int, lowMemory bool) io.WriteCloser
+
+// A contentEncoder is a content encoding added with ContentEncoding.
+type contentEncoder struct {
+	name string
+	enc  Encoder
+}
+
+// ContentEncoding makes ForHTTP offer another content encoding, such as zstd,
+// compressed by enc, so that the escaper package doesn't need to depend on
+// an implementation of it. Encodings added this way are preferred over gzip,
+// but not over brotli, in the order they were added. For example, with
+// github.com/klauspost/compress/zstd:
+//
+//	escaper.ContentEncoding("zstd", func(w io.Writer, level int, lowMemory bool) io.WriteCloser {
+//		// Browsers don't accept windows larger than 8 MB.
+//		window := 8 << 20
+//		if lowMemory {
+//			window = 64 << 10
+//		}
+//		z, _ := zstd.NewWriter(w, zstd.WithEncoderConcurrency(1), zstd.WithWindowSize(window))
+//		return z
+//	})
+func ContentEncoding(name string, enc Encoder) HTTPOption {
+	return func(c *httpConfig) {
+		c.encoders = append(c.encoders, contentEncoder{strings.ToLower(name), enc})
+	}
+}
+
+// encoder returns the Encoder for the content encoding name, which was added
+// with ContentEncoding.
+func (c *httpConfig) encoder(name string) Encoder {
+	for _, ce := range c.encoders {
+		if ce.name == name {
+			return ce.enc
+		}
+	}
+	return nil
+}
+
+// gzipLevel returns the compression level for the gzip Writer.
+func (c *httpConfig) gzipLevel() int {
+	if c.level == 0 {
+		return gzip.DefaultCompression
+	}
+	return c.level
+}
+
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error { return nil }
+
+// negotiateEncoding returns the best of offers (listed in order of
+// preference) according to the Accept-Encoding header values in accept, or
+// "" if none of them is acceptable.
+//
+// The parsing is lenient, since clients send all kinds of malformed headers:
+// case is ignored, as are empty elements and extra white space. If an
+// encoding is listed more than once, its highest weight is used.
+func negotiateEncoding(accept []string, offers ...string) string {
+	weights := make(map[string]float64)
+	for _, h := range accept {
+		for _, elem := range strings.Split(h, ",") {
+			params := strings.Split(elem, ";")
+			name := strings.ToLower(strings.TrimSpace(params[0]))
+			if name == "" {
+				continue
+			}
+			q := 1.0
+			for _, p := range params[1:] {
+				p = strings.TrimSpace(p)
+				if len(p) > 2 && (p[0] == 'q' || p[0] == 'Q') && p[1] == '=' {
+					if f, err := strconv.ParseFloat(p[2:], 64); err == nil && f >= 0 && f <= 1 {
+						q = f
+					}
+				}
+			}
+			if old, ok := weights[name]; !ok || q > old {
+				weights[name] = q
+			}
+		}
+	}
+
+	best, bestQ := "", 0.0
+	for _, offer := range offers {
+		q, ok := weights[offer]
+		if !ok {
+			q, ok = weights["*"]
+		}
+		if ok && q > bestQ {
+			best, bestQ = offer, q
+		}
+	}
+	return best
 }
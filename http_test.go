@@ -0,0 +1,599 @@
+package escaper
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httptrace"
+	"net/textproto"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+)
+
+func TestNegotiateEncoding(t *testing.T) {
+	tests := []struct {
+		accept []string
+		want   string
+	}{
+		{nil, ""},
+		{[]string{""}, ""},
+		{[]string{"gzip"}, "gzip"},
+		{[]string{"gzip, deflate, br"}, "br"},
+		{[]string{"gzip, gzip, br"}, "br"},
+		{[]string{"GZIP"}, "gzip"},
+		{[]string{"Br, GZip"}, "br"},
+		{[]string{" , gzip ,, "}, "gzip"},
+		{[]string{"  gzip  ;  q=0.5  ,  zstd;q=0.4 "}, "gzip"},
+		{[]string{"gzip;q=0.5, gzip;q=1, br;q=0.8"}, "gzip"},
+		{[]string{"gzip;q=1, gzip;q=0"}, "gzip"},
+		{[]string{"gzip;Q=0.2, zstd;q=0.3"}, "zstd"},
+		{[]string{"gzip;q=abc"}, "gzip"},
+		{[]string{"gzip;q=2, br;q=0.5"}, "gzip"},
+		{[]string{"br;q=0, gzip;q=0"}, ""},
+		{[]string{"gzip", "br"}, "br"},
+		{[]string{"*"}, "br"},
+		{[]string{"br;q=0, *"}, "zstd"},
+		{[]string{"deflate, identity"}, ""},
+	}
+	for _, tt := range tests {
+		if got := negotiateEncoding(tt.accept, "br", "zstd", "gzip"); got != tt.want {
+			t.Errorf("negotiateEncoding(%q) = %q, want %q", tt.accept, got, tt.want)
+		}
+	}
+}
+
+func TestForHTTPMalformedAcceptEncoding(t *testing.T) {
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("Accept-Encoding", "GZIP, , gzip ,")
+	w := httptest.NewRecorder()
+	e, c := ForHTTP(w, r)
+	e.Literal("<p>Hello</p>")
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if got := w.Header().Get("Content-Encoding"); got != "gzip" {
+		t.Errorf("Content-Encoding = %q, want gzip", got)
+	}
+}
+
+func TestLowMemory(t *testing.T) {
+	tests := []struct {
+		name    string
+		options []HTTPOption
+		quality int
+		lgwin   int
+	}{
+		{"default", nil, brotli.DefaultCompression, 0},
+		{"LowMemory", []HTTPOption{LowMemory()}, lowMemoryQuality, lowMemoryLGWin},
+		{"high level", []HTTPOption{CompressionLevel(9), LowMemory()}, lowMemoryQuality, lowMemoryLGWin},
+		{"low level", []HTTPOption{LowMemory(), CompressionLevel(1)}, 1, lowMemoryLGWin},
+	}
+	for _, tt := range tests {
+		var c httpConfig
+		for _, o := range tt.options {
+			o(&c)
+		}
+		o := c.brotliOptions()
+		if o.Quality != tt.quality || o.LGWin != tt.lgwin {
+			t.Errorf("%s: brotli quality %d, window %d; want %d, %d", tt.name, o.Quality, o.LGWin, tt.quality, tt.lgwin)
+		}
+
+		// LowMemory is passed on to encoders from ContentEncoding.
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Header.Set("Accept-Encoding", "x-test")
+		w := httptest.NewRecorder()
+		var lowMemory bool
+		e, closer := ForHTTP(w, r, append(tt.options, ContentEncoding("x-test", func(w io.Writer, level int, lm bool) io.WriteCloser {
+			lowMemory = lm
+			return nopCloser{w}
+		}))...)
+		e.Literal("<p>Hello</p>")
+		if err := closer.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if want := tt.lgwin != 0; lowMemory != want {
+			t.Errorf("%s: Encoder got lowMemory %v, want %v", tt.name, lowMemory, want)
+		}
+	}
+}
+
+func TestContentDisposition(t *testing.T) {
+	tests := []struct {
+		disposition, filename string
+		want                  string
+	}{
+		{"inline", "", "inline"},
+		{"attachment", "report.html", `attachment; filename="report.html"; filename*=UTF-8''report.html`},
+		{"attachment", "My Report.html", `attachment; filename="My Report.html"; filename*=UTF-8''My%20Report.html`},
+		{"attachment", "Report é.html", `attachment; filename="Report _.html"; filename*=UTF-8''Report%20%C3%A9.html`},
+		{"attachment", `a"b\c.html`, `attachment; filename="a_b_c.html"; filename*=UTF-8''a%22b%5Cc.html`},
+		{"attachment", "a\r\nb", `attachment; filename="a__b"; filename*=UTF-8''a%0D%0Ab`},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", "/", nil)
+		w := httptest.NewRecorder()
+		e, c := ForHTTP(w, r, ContentDisposition(tt.disposition, tt.filename))
+		e.Literal("<p>Report</p>")
+		c.Close()
+		if got := w.Header().Get("Content-Disposition"); got != tt.want {
+			t.Errorf("ContentDisposition(%q, %q): got %q, want %q", tt.disposition, tt.filename, got, tt.want)
+		}
+	}
+}
+
+// deflateEncoding adds the deflate content encoding with ContentEncoding.
+func deflateEncoding() HTTPOption {
+	return ContentEncoding("deflate", func(w io.Writer, level int, lowMemory bool) io.WriteCloser {
+		if level == 0 {
+			level = flate.DefaultCompression
+		}
+		// NewWriter only fails with an invalid level.
+		f, _ := flate.NewWriter(w, level)
+		return f
+	})
+}
+
+// decodeBody returns the body of a response, decompressed according to its
+// Content-Encoding header.
+func decodeBody(t *testing.T, w *httptest.ResponseRecorder) string {
+	t.Helper()
+	var r io.Reader = bytes.NewReader(w.Body.Bytes())
+	switch enc := w.Header().Get("Content-Encoding"); enc {
+	case "":
+	case "br":
+		r = brotli.NewReader(r)
+	case "deflate":
+		r = flate.NewReader(r)
+	case "gzip":
+		g, err := gzip.NewReader(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r = g
+	default:
+		t.Fatalf("unexpected Content-Encoding %q", enc)
+	}
+	b, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func TestForHTTPFlush(t *testing.T) {
+	tests := []struct {
+		name        string
+		encoding    string
+		options     []HTTPOption
+		wantFlushed bool
+	}{
+		{"identity", "", nil, true},
+		{"gzip", "gzip", nil, true},
+		{"br", "br", nil, true},
+		{"deflate", "deflate", []HTTPOption{deflateEncoding()}, true},
+		{"MinCompressSize", "gzip", []HTTPOption{MinCompressSize(1000)}, true},
+		{"DeferHeaders", "gzip", []HTTPOption{DeferHeaders(1000)}, true},
+		{"Buffered", "gzip", []HTTPOption{Buffered()}, false},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Header.Set("Accept-Encoding", tt.encoding)
+		w := httptest.NewRecorder()
+		e, c := ForHTTP(w, r, tt.options...)
+		e.Literal("<p>Hello</p>")
+		if err := e.Flush(); err != nil {
+			t.Errorf("%s: Flush: %v", tt.name, err)
+		}
+		if w.Flushed != tt.wantFlushed {
+			t.Errorf("%s: Flushed = %v, want %v", tt.name, w.Flushed, tt.wantFlushed)
+		}
+		if sent := w.Body.Len() > 0; sent != tt.wantFlushed {
+			t.Errorf("%s: %d bytes sent after Flush", tt.name, w.Body.Len())
+		}
+		if got := w.Header().Get("Content-Encoding"); tt.wantFlushed && got != tt.encoding {
+			t.Errorf("%s: Content-Encoding = %q, want %q", tt.name, got, tt.encoding)
+		}
+		e.Literal("<p>Goodbye</p>")
+		if err := c.Close(); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if got, want := decodeBody(t, w), "<p>Hello</p><p>Goodbye</p>"; got != want {
+			t.Errorf("%s: body %q, want %q", tt.name, got, want)
+		}
+	}
+}
+
+func TestForHTTPEncodings(t *testing.T) {
+	page := strings.Repeat("<p>Hello, world!</p>\n", 100)
+	tests := []struct {
+		accept string
+		want   string
+	}{
+		{"", ""},
+		{"gzip", "gzip"},
+		{"deflate", "deflate"},
+		{"br", "br"},
+		{"gzip, deflate", "deflate"},
+		{"gzip, deflate, br", "br"},
+		{"DEFLATE;q=1, br;q=0.5", "deflate"},
+		{"zstd", ""},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Header.Set("Accept-Encoding", tt.accept)
+		w := httptest.NewRecorder()
+		e, c := ForHTTP(w, r, deflateEncoding())
+		e.Literal(page)
+		if err := c.Close(); err != nil {
+			t.Fatalf("%q: %v", tt.accept, err)
+		}
+		if got := w.Header().Get("Content-Encoding"); got != tt.want {
+			t.Errorf("%q: Content-Encoding = %q, want %q", tt.accept, got, tt.want)
+		}
+		if got := w.Header().Get("Vary"); got != "Accept-Encoding" {
+			t.Errorf("%q: Vary = %q", tt.accept, got)
+		}
+		if got := w.Header().Get("Content-Type"); got != "text/html; charset=utf-8" {
+			t.Errorf("%q: Content-Type = %q", tt.accept, got)
+		}
+		if got := decodeBody(t, w); got != page {
+			t.Errorf("%q: wrong body (%d bytes)", tt.accept, len(got))
+		}
+	}
+}
+
+func TestHTTPOptions(t *testing.T) {
+	short := "<p>Hi</p>"
+	long := strings.Repeat("<p>Hello, world!</p>\n", 100)
+	tests := []struct {
+		name        string
+		options     []HTTPOption
+		page        string
+		encoding    string
+		contentType string
+		vary        string
+	}{
+		{"default", nil, short, "gzip", "text/html; charset=utf-8", "Accept-Encoding"},
+		{"NoCompression", []HTTPOption{NoCompression()}, long, "", "text/html; charset=utf-8", ""},
+		{"MinCompressSize short", []HTTPOption{MinCompressSize(100)}, short, "", "text/html; charset=utf-8", "Accept-Encoding"},
+		{"MinCompressSize long", []HTTPOption{MinCompressSize(100)}, long, "gzip", "text/html; charset=utf-8", "Accept-Encoding"},
+		{"ContentType", []HTTPOption{ContentType("image/svg+xml")}, short, "gzip", "image/svg+xml", "Accept-Encoding"},
+		{"CompressionLevel", []HTTPOption{CompressionLevel(1)}, long, "gzip", "text/html; charset=utf-8", "Accept-Encoding"},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Header.Set("Accept-Encoding", "gzip")
+		w := httptest.NewRecorder()
+		e, c := ForHTTP(w, r, tt.options...)
+		e.Literal(tt.page)
+		if err := c.Close(); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if got := w.Header().Get("Content-Encoding"); got != tt.encoding {
+			t.Errorf("%s: Content-Encoding = %q, want %q", tt.name, got, tt.encoding)
+		}
+		if got := w.Header().Get("Content-Type"); got != tt.contentType {
+			t.Errorf("%s: Content-Type = %q, want %q", tt.name, got, tt.contentType)
+		}
+		if got := w.Header().Get("Vary"); got != tt.vary {
+			t.Errorf("%s: Vary = %q, want %q", tt.name, got, tt.vary)
+		}
+		if got := decodeBody(t, w); got != tt.page {
+			t.Errorf("%s: body %q, want %q", tt.name, got, tt.page)
+		}
+	}
+}
+
+func TestCompressionLevel(t *testing.T) {
+	tests := []struct {
+		level        int
+		gzip, brotli int
+	}{
+		{0, gzip.DefaultCompression, brotli.DefaultCompression},
+		{-5, 1, 1},
+		{1, 1, 1},
+		{5, 5, 6},
+		{9, 9, brotli.BestCompression},
+		{20, 9, brotli.BestCompression},
+	}
+	for _, tt := range tests {
+		var c httpConfig
+		if tt.level != 0 {
+			CompressionLevel(tt.level)(&c)
+		}
+		if got := c.gzipLevel(); got != tt.gzip {
+			t.Errorf("level %d: gzip level %d, want %d", tt.level, got, tt.gzip)
+		}
+		if got := c.brotliOptions().Quality; got != tt.brotli {
+			t.Errorf("level %d: brotli quality %d, want %d", tt.level, got, tt.brotli)
+		}
+		if c.level != tt.gzip && tt.level != 0 {
+			t.Errorf("level %d: Encoder level %d, want %d", tt.level, c.level, tt.gzip)
+		}
+	}
+}
+
+func TestETag(t *testing.T) {
+	page := "<p>Hello</p>"
+	etag := bodyETag([]byte(page))
+	tests := []struct {
+		name        string
+		method      string
+		ifNoneMatch string
+		wantCode    int
+		wantBody    string
+	}{
+		{"no If-None-Match", "GET", "", 200, page},
+		{"match", "GET", etag, 304, ""},
+		{"strong match", "GET", etag[2:], 304, ""},
+		{"match in list", "GET", `"a", ` + etag, 304, ""},
+		{"star", "GET", "*", 304, ""},
+		{"no match", "GET", `W/"abc"`, 200, page},
+		{"HEAD", "HEAD", etag, 304, ""},
+		{"POST", "POST", etag, 200, page},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(tt.method, "/", nil)
+		r.Header.Set("Accept-Encoding", "gzip")
+		if tt.ifNoneMatch != "" {
+			r.Header.Set("If-None-Match", tt.ifNoneMatch)
+		}
+		w := httptest.NewRecorder()
+		e, c := ForHTTP(w, r, ETag())
+		e.Literal(page)
+		if w.Body.Len() != 0 || w.Code != 200 || len(w.Header()["ETag"]) != 0 {
+			t.Errorf("%s: response started before Close", tt.name)
+		}
+		if err := c.Close(); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if w.Code != tt.wantCode {
+			t.Errorf("%s: status %d, want %d", tt.name, w.Code, tt.wantCode)
+		}
+		if got := w.Header().Get("ETag"); got != etag {
+			t.Errorf("%s: ETag %q, want %q", tt.name, got, etag)
+		}
+		if tt.wantCode == 304 {
+			if w.Body.Len() != 0 {
+				t.Errorf("%s: 304 response has a body", tt.name)
+			}
+			continue
+		}
+		if got := decodeBody(t, w); got != tt.wantBody {
+			t.Errorf("%s: body %q, want %q", tt.name, got, tt.wantBody)
+		}
+	}
+
+	// The ETag doesn't depend on the content encoding.
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("Accept-Encoding", "br")
+	w := httptest.NewRecorder()
+	e, c := ForHTTP(w, r, ETag())
+	e.Literal(page)
+	c.Close()
+	if got := w.Header().Get("ETag"); got != etag {
+		t.Errorf("br: ETag %q, want %q", got, etag)
+	}
+	if other := bodyETag([]byte("<p>Goodbye</p>")); other == etag {
+		t.Errorf("different pages have the same ETag %q", etag)
+	}
+}
+
+func TestBuffered(t *testing.T) {
+	page := strings.Repeat("<p>Hello, world!</p>\n", 100)
+	for _, enc := range []string{"", "gzip", "br", "deflate"} {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Header.Set("Accept-Encoding", enc)
+		w := httptest.NewRecorder()
+		e, c := ForHTTP(w, r, Buffered(), deflateEncoding())
+		e.Literal(page)
+		if w.Body.Len() != 0 {
+			t.Errorf("%q: response started before Close", enc)
+		}
+		if err := c.Close(); err != nil {
+			t.Fatalf("%q: %v", enc, err)
+		}
+		if got, want := w.Header().Get("Content-Length"), strconv.Itoa(w.Body.Len()); got != want {
+			t.Errorf("%q: Content-Length %s, want %s", enc, got, want)
+		}
+		if got := w.Header().Get("Content-Encoding"); got != enc {
+			t.Errorf("%q: Content-Encoding %q", enc, got)
+		}
+		if got := decodeBody(t, w); got != page {
+			t.Errorf("%q: wrong body (%d bytes)", enc, len(got))
+		}
+		// Closing again does nothing.
+		n := w.Body.Len()
+		if err := c.Close(); err != nil || w.Body.Len() != n {
+			t.Errorf("%q: second Close: %v, %d more bytes", enc, err, w.Body.Len()-n)
+		}
+	}
+
+	// A page that fails to render is replaced with an error.
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("Accept-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	e, c := ForHTTP(w, r, Buffered(), ContentDisposition("attachment", "a.html"))
+	e.Literal("<p>Secret partial page</p>")
+	e.Literal(`<a href="x"<`)
+	err := c.Close()
+	if !errors.Is(err, ErrBadHTML) {
+		t.Errorf("error page: Close returned %v, want ErrBadHTML", err)
+	}
+	if w.Code != 500 {
+		t.Errorf("error page: status %d, want 500", w.Code)
+	}
+	if strings.Contains(w.Body.String(), "Secret") {
+		t.Errorf("error page: partial page was sent: %q", w.Body.String())
+	}
+	if got := w.Header().Get("Content-Disposition"); got != "" {
+		t.Errorf("error page: Content-Disposition %q", got)
+	}
+	if got := w.Header().Get("Content-Encoding"); got != "" {
+		t.Errorf("error page: Content-Encoding %q", got)
+	}
+}
+
+func TestEarlyHints(t *testing.T) {
+	links := []string{"</style.css>; rel=preload; as=style", "</app.js>; rel=preload; as=script"}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		e, c := ForHTTP(w, r, EarlyHints(links...))
+		defer c.Close()
+		e.Literal("<p>Hello</p>")
+	}))
+	defer ts.Close()
+
+	var hints []http.Header
+	trace := &httptrace.ClientTrace{
+		Got1xxResponse: func(code int, header textproto.MIMEHeader) error {
+			if code == http.StatusEarlyHints {
+				hints = append(hints, http.Header(header))
+			}
+			return nil
+		},
+	}
+	req, err := http.NewRequest("GET", ts.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req = req.WithContext(httptrace.WithClientTrace(req.Context(), trace))
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(hints) != 1 {
+		t.Fatalf("got %d Early Hints responses, want 1", len(hints))
+	}
+	if got := hints[0]["Link"]; !reflect.DeepEqual(got, links) {
+		t.Errorf("Early Hints Link headers %q, want %q", got, links)
+	}
+	if resp.StatusCode != 200 {
+		t.Errorf("status %d, want 200", resp.StatusCode)
+	}
+	if got := resp.Header["Link"]; !reflect.DeepEqual(got, links) {
+		t.Errorf("final Link headers %q, want %q", got, links)
+	}
+	if string(body) != "<p>Hello</p>" {
+		t.Errorf("body %q", body)
+	}
+}
+
+func TestDeferHeaders(t *testing.T) {
+	tests := []struct {
+		name     string
+		render   func(e *Escaper) error
+		wantCode int
+		wantBody string
+		wantErr  error
+	}{
+		{
+			"Status",
+			func(e *Escaper) error {
+				e.Literal("<p>Not found</p>")
+				return e.Status(404)
+			},
+			404,
+			"<p>Not found</p>",
+			nil,
+		},
+		{
+			"Discard",
+			func(e *Escaper) error {
+				e.Literal(`<p>Partial <a href="`)
+				if err := e.Discard(); err != nil {
+					return err
+				}
+				e.Status(500)
+				e.Literal("<p>Error</p>")
+				return nil
+			},
+			500,
+			"<p>Error</p>",
+			nil,
+		},
+		{
+			"Discard after error",
+			func(e *Escaper) error {
+				e.Literal(`<a href="x"<`)
+				e.Discard()
+				return e.Literal("<p>Error</p>")
+			},
+			200,
+			"<p>Error</p>",
+			nil,
+		},
+		{
+			"Status after Flush",
+			func(e *Escaper) error {
+				e.Literal("<p>Hello</p>")
+				e.Flush()
+				return e.Status(404)
+			},
+			200,
+			"<p>Hello</p>",
+			ErrHeadersSent,
+		},
+		{
+			"Discard after Flush",
+			func(e *Escaper) error {
+				e.Literal("<p>Hello</p>")
+				e.Flush()
+				return e.Discard()
+			},
+			200,
+			"<p>Hello</p>",
+			ErrHeadersSent,
+		},
+		{
+			"Status after limit",
+			func(e *Escaper) error {
+				e.Literal(strings.Repeat("x", 100))
+				return e.Status(404)
+			},
+			200,
+			strings.Repeat("x", 100),
+			ErrHeadersSent,
+		},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Header.Set("Accept-Encoding", "gzip")
+		w := httptest.NewRecorder()
+		e, c := ForHTTP(w, r, DeferHeaders(50))
+		err := tt.render(e)
+		if !errors.Is(err, tt.wantErr) || (err != nil) != (tt.wantErr != nil) {
+			t.Errorf("%s: got error %v, want %v", tt.name, err, tt.wantErr)
+		}
+		if err := c.Close(); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if w.Code != tt.wantCode {
+			t.Errorf("%s: status %d, want %d", tt.name, w.Code, tt.wantCode)
+		}
+		if got := decodeBody(t, w); got != tt.wantBody {
+			t.Errorf("%s: body %q, want %q", tt.name, got, tt.wantBody)
+		}
+	}
+
+	e := New(io.Discard)
+	if err := e.Status(404); !errors.Is(err, ErrHeadersSent) {
+		t.Errorf("Status without ForHTTP: got %v", err)
+	}
+	if err := e.Discard(); !errors.Is(err, ErrHeadersSent) {
+		t.Errorf("Discard without ForHTTP: got %v", err)
+	}
+}
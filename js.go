@@ -14,6 +14,50 @@ import (
 	"unicode/utf8"
 )
 
+// jsonScriptEscaper encodes v as JSON that is safe to use as the content of
+// a script element. Besides the quoting done by encoding/json, which writes
+// '<', '>', and '&' as \u escapes (even in the output of MarshalJSON
+// methods), this means that "</script" and "<!--" cannot occur in the
+// result.
+func jsonScriptEscaper(v interface{}) (string, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return "", errorf(ErrJSON, "cannot encode %T as JSON: %v", v, err)
+	}
+	return string(b), nil
+}
+
+// isJSONType reports whether mimeType, the type of a script element, is a
+// JSON type, so that the element contains data instead of code. Import maps
+// and speculation rules are JSON too.
+//
+// Module scripts (type="module") are JavaScript, and they are escaped the
+// same way as classic scripts. The differences between them, such as the
+// HTML-like comments that classic scripts allow, don't affect the context
+// that values are written in, since values never contain "<!--" or "-->".
+func isJSONType(mimeType string) bool {
+	if i := strings.IndexByte(mimeType, ';'); i != -1 {
+		mimeType = mimeType[:i]
+	}
+	switch mimeType = strings.ToLower(strings.TrimSpace(mimeType)); mimeType {
+	case "application/json", "importmap", "speculationrules":
+		return true
+	}
+	return strings.HasSuffix(mimeType, "+json")
+}
+
+// jsonStrEscaper produces a string that can be included between double quotes
+// in a JSON script element. Unlike jsStrEscaper, it only uses the escapes
+// that are valid in JSON.
+func jsonStrEscaper(args ...interface{}) string {
+	s, ok := jsonMarshalerString(args)
+	if !ok {
+		s, _ = stringify(args...)
+	}
+	b, _ := json.Marshal(s)
+	return string(b[1 : len(b)-1])
+}
+
 // nextJSCtx returns the context that determines whether a slash after the
 // given run of tokens starts a regular expression instead of a division
 // operator: / or /=.
@@ -124,6 +168,10 @@ var jsonMarshalType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
 // indirectToJSONMarshaler returns the value, after dereferencing as many times
 // as necessary to reach the base type (or nil) or an implementation of json.Marshal.
 func indirectToJSONMarshaler(a interface{}) interface{} {
+	if a == nil {
+		// An untyped nil has no type to call methods on; it becomes null.
+		return nil
+	}
 	v := reflect.ValueOf(a)
 	for !v.Type().Implements(jsonMarshalType) && v.Kind() == reflect.Ptr && !v.IsNil() {
 		v = v.Elem()
@@ -131,12 +179,45 @@ func indirectToJSONMarshaler(a interface{}) interface{} {
 	return v.Interface()
 }
 
+// jsonMarshalerString returns the text to use in a JS string for a single
+// argument that implements json.Marshaler: the contents of the JSON string it
+// is marshaled to, or the JSON text itself if it is not a string. It returns
+// false if args is not a single json.Marshaler, or if marshaling fails.
+func jsonMarshalerString(args []interface{}) (string, bool) {
+	if len(args) != 1 {
+		return "", false
+	}
+	m, ok := indirectToJSONMarshaler(toTrusted(args[0])).(json.Marshaler)
+	if !ok {
+		return "", false
+	}
+	// The JS string escaper takes care of HTML specials, so don't let the
+	// encoder escape them too.
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(m); err != nil {
+		return "", false
+	}
+	b := bytes.TrimSuffix(buf.Bytes(), []byte("\n"))
+	var s string
+	if json.Unmarshal(b, &s) == nil {
+		return s, true
+	}
+	return string(b), true
+}
+
 // jsValEscaper escapes its inputs to a JS Expression (section 11.14) that has
 // neither side-effects nor free variables outside (NaN, Infinity).
+// Since the output is always a data literal (a string, number, boolean, null,
+// array, or object), never an identifier, code that follows it, such as the
+// property access in `var x = {{.}}.foo`, applies to the data: the string
+// "window" can't give access to the global object. Numbers, booleans, and null
+// are padded with spaces, so that `{{.}}.foo` becomes ` 1 .foo`, not `1.foo`.
 func jsValEscaper(args ...interface{}) string {
 	var a interface{}
 	if len(args) == 1 {
-		a = indirectToJSONMarshaler(args[0])
+		a = indirectToJSONMarshaler(toTrusted(args[0]))
 		switch t := a.(type) {
 		case template.JS:
 			return string(t)
@@ -168,9 +249,11 @@ func jsValEscaper(args ...interface{}) string {
 		return fmt.Sprintf(" /* %s */null ", strings.Replace(err.Error(), "*/", "* /", -1))
 	}
 
-	// TODO: maybe post-process output to prevent it from containing
-	// "<!--", "-->", "<![CDATA[", "]]>", or "</script"
-	// in case custom marshallers produce output containing those.
+	// The output can't contain "<!--", "-->", "<![CDATA[", "]]>", or
+	// "</script", which could confuse the HTML parser's script data states,
+	// since json.Marshal escapes '<', '>', and '&' as \u escapes, even in
+	// the output of custom marshalers. The string and regexp escapers
+	// escape them as \x escapes.
 
 	// TODO: Maybe abbreviate \u00ab to \xab to produce more compact output.
 	if len(b) == 0 {
@@ -219,6 +302,9 @@ func jsValEscaper(args ...interface{}) string {
 // JavaScript source, in JavaScript embedded in an HTML5 <script> element,
 // or in an HTML5 event handler attribute such as onclick.
 func jsStrEscaper(args ...interface{}) string {
+	if s, ok := jsonMarshalerString(args); ok {
+		return replace(s, jsStrReplacementTable)
+	}
 	s, t := stringify(args...)
 	if t == contentTypeJSStr {
 		return replace(s, jsStrNormReplacementTable)
@@ -363,3 +449,17 @@ func isJSIdentPart(r rune) bool {
 	}
 	return false
 }
+
+// isJSIdentifier reports whether s is an identifier made of ASCII
+// characters.
+func isJSIdentifier(s string) bool {
+	if s == "" || '0' <= s[0] && s[0] <= '9' {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if !isJSIdentPart(rune(s[i])) {
+			return false
+		}
+	}
+	return true
+}
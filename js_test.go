@@ -0,0 +1,113 @@
+package escaper
+
+import (
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"testing"
+)
+
+func TestTrustedJS(t *testing.T) {
+	runValueTests(t, nil, []valueTest{
+		{"template.JS object", "<script>var x = ", ";</script>", template.JS(`{"a":1}`), `<script>var x = {"a":1};</script>`},
+		{"string object", "<script>var x = ", ";</script>", `{"a":1}`, `<script>var x = "{\"a\":1}";</script>`},
+		{"template.JS call", "<script>", "</script>", template.JS("f(1)"), "<script>f(1)</script>"},
+		{"template.JS in string", "<script>var s = '", "';</script>", template.JS(`a'b`), `<script>var s = 'a\x27b';</script>`},
+		{"template.JS in handler", `<a onclick="`, `">`, template.JS(`f("x")`), `<a onclick="f(&#34;x&#34;)">`},
+		{"template.JSStr", "<script>var s = '", "';</script>", template.JSStr(`a\nb`), `<script>var s = 'a\nb';</script>`},
+		{"string with escape", "<script>var s = '", "';</script>", `a\nb`, `<script>var s = 'a\\nb';</script>`},
+		{"template.JS in text", "<p>", "</p>", template.JS("<b>"), "<p>&lt;b&gt;</p>"},
+	})
+}
+
+func TestScriptDataEscaped(t *testing.T) {
+	runValueTests(t, nil, []valueTest{
+		{"string", "<script>var x = ", ";</script>", "<!--<script>", `<script>var x = "\u003c!--\u003cscript\u003e";</script>`},
+		{"upper case", "<script>var x = ", ";</script>", "<!--<SCRIPT>", `<script>var x = "\u003c!--\u003cSCRIPT\u003e";</script>`},
+		{"end", "<script>var x = ", ";</script>", "-->", `<script>var x = "--\u003e";</script>`},
+		{"end tag", "<script>var x = ", ";</script>", "</ScRiPt>", `<script>var x = "\u003c/ScRiPt\u003e";</script>`},
+		{"in string", "<script>var s = '", "';</script>", "<!--<script>", `<script>var s = '\x3c!--\x3cscript\x3e';</script>`},
+		{"in regexp", "<script>var r = /", "/;</script>", "<!--<script>", `<script>var r = /\x3c!\-\-\x3cscript\x3e/;</script>`},
+		{"JSON", "<script>var x = ", ";</script>", map[string]string{"a": "<!--<script>"}, `<script>var x = {"a":"\u003c!--\u003cscript\u003e"};</script>`},
+		{"style", "<style>p { content: '", "' }</style>", "<!--</style>", `<style>p { content: '\3c!--\3c\2fstyle\3e ' }</style>`},
+	})
+}
+
+func TestJSValuesAreData(t *testing.T) {
+	runValueTests(t, nil, []valueTest{
+		{"identifier", "<script>var x = ", ".foo;</script>", "window", `<script>var x = "window".foo;</script>`},
+		{"expression", "<script>var x = ", ".foo;</script>", "alert(1)", `<script>var x = "alert(1)".foo;</script>`},
+		{"number", "<script>var x = ", ".foo;</script>", 42, `<script>var x =  42 .foo;</script>`},
+		{"bool", "<script>var x = ", ".foo;</script>", true, `<script>var x =  true .foo;</script>`},
+		{"nil", "<script>var x = ", ".foo;</script>", nil, `<script>var x =  null .foo;</script>`},
+		{"object", "<script>var x = ", ".foo;</script>", map[string]int{"foo": 1}, `<script>var x = {"foo":1}.foo;</script>`},
+		{"slice", "<script>var x = ", "[0];</script>", []string{"a"}, `<script>var x = ["a"][0];</script>`},
+		{"call", "<script>f(", ");</script>", "document.cookie", `<script>f("document.cookie");</script>`},
+		{"handler", `<a onclick="`, `.foo">`, "window", `<a onclick="&#34;window&#34;.foo">`},
+	})
+}
+
+func TestJSONScript(t *testing.T) {
+	runValueTests(t, nil, []valueTest{
+		{"object", `<script type="application/json">`, "</script>", map[string]string{"a": "</script><!--"}, `<script type="application/json">{"a":"\u003c/script\u003e\u003c!--"}</script>`},
+		{"line separators", `<script type="application/json">`, "</script>", "a\u2028b\u2029", `<script type="application/json">"a\u2028b\u2029"</script>`},
+		{"number", `<script type="application/json">[`, "]</script>", 1.5, `<script type="application/json">[1.5]</script>`},
+		{"nil", `<script type="application/json">`, "</script>", nil, `<script type="application/json">null</script>`},
+		{"in string", `<script type="application/json">{"a": "`, `"}</script>`, "'</script>\n", `<script type="application/json">{"a": "'\u003c/script\u003e\n"}</script>`},
+		{"type with parameters", `<script type="Application/JSON; charset=utf-8">`, "</script>", "'", `<script type="Application/JSON; charset=utf-8">"'"</script>`},
+		{"+json type", `<script type='application/ld+json'>`, "</script>", "'", `<script type='application/ld+json'>"'"</script>`},
+		{"unquoted type", `<script type=application/json>`, "</script>", "'", `<script type=application/json>"'"</script>`},
+		{"entity in type", `<script type="application&#47;json">`, "</script>", "'", `<script type="application&#47;json">"'"</script>`},
+		{"trusted JS", `<script type="application/json">`, "</script>", template.JS(`{"a":1}`), `<script type="application/json">{"a":1}</script>`},
+		{"JavaScript", `<script type="text/javascript">`, "</script>", "'", `<script type="text/javascript">"'"</script>`},
+	})
+
+	e := New(io.Discard)
+	e.Literal(`<script type="application/json">`)
+	var ee *Error
+	if err := e.Value(func() {}); !errors.As(err, &ee) || ee.ErrorCode != ErrJSON {
+		t.Errorf("unencodable value: got error %v, want ErrJSON", err)
+	}
+}
+
+func TestScriptTypes(t *testing.T) {
+	runValueTests(t, nil, []valueTest{
+		{"module", `<script type="module">import x from `, ";</script>", "./a.js", `<script type="module">import x from "./a.js";</script>`},
+		{"module string", `<script type="module">import x from "`, `";</script>`, "</script>", `<script type="module">import x from "\x3c\/script\x3e";</script>`},
+		{"importmap", `<script type="importmap">{"imports": {"a": `, "}}</script>", "/a.js", `<script type="importmap">{"imports": {"a": "/a.js"}}</script>`},
+		{"importmap string", `<script type="importmap">{"imports": {"a": "`, `"}}</script>`, "</script>'", `<script type="importmap">{"imports": {"a": "\u003c/script\u003e'"}}</script>`},
+		{"speculationrules", `<script type="speculationrules">`, "</script>", map[string]int{"a": 1}, `<script type="speculationrules">{"a":1}</script>`},
+		{"after importmap", `<script type="importmap">{}</script><script>var x = `, ";</script>", "'", `<script type="importmap">{}</script><script>var x = "'";</script>`},
+	})
+}
+
+type jsonDate struct{ y, m, d int }
+
+func (d jsonDate) MarshalJSON() ([]byte, error) {
+	return []byte(fmt.Sprintf(`"%04d-%02d-%02d</script>"`, d.y, d.m, d.d)), nil
+}
+
+type jsonPoint struct{ x, y int }
+
+func (p *jsonPoint) MarshalJSON() ([]byte, error) {
+	return []byte(fmt.Sprintf(`{"x":%d,"y":%d}`, p.x, p.y)), nil
+}
+
+type jsonFailer struct{}
+
+func (jsonFailer) MarshalJSON() ([]byte, error) { return nil, errors.New("no") }
+
+func (jsonFailer) String() string { return "failer" }
+
+func TestJSONMarshalerValues(t *testing.T) {
+	runValueTests(t, nil, []valueTest{
+		{"value", "<script>var x = ", ";</script>", jsonDate{2024, 3, 5}, `<script>var x = "2024-03-05\u003c/script\u003e";</script>`},
+		{"pointer", "<script>var x = ", ";</script>", &jsonPoint{1, 2}, `<script>var x = {"x":1,"y":2};</script>`},
+		{"string", `<script>var x = "`, `";</script>`, jsonDate{2024, 3, 5}, `<script>var x = "2024-03-05\x3c\/script\x3e";</script>`},
+		{"object in string", `<script>var x = '`, `';</script>`, &jsonPoint{1, 2}, `<script>var x = '{\x22x\x22:1,\x22y\x22:2}';</script>`},
+		{"event handler", `<a onclick="f(`, `)">`, jsonDate{2024, 3, 5}, `<a onclick="f(&#34;2024-03-05\u003c/script\u003e&#34;)">`},
+		{"error in string", `<script>var x = "`, `";</script>`, jsonFailer{}, `<script>var x = "failer";</script>`},
+		{"text", "<p>", "</p>", jsonDate{2024, 3, 5}, "<p>{2024 3 5}</p>"},
+	})
+}
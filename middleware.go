@@ -0,0 +1,118 @@
+package escaper
+
+import (
+	stdcontext "context"
+	"io"
+	"log"
+	"net/http"
+	"runtime/debug"
+)
+
+// contextKey is the key for the requestEscaper in a request's context.
+type contextKey struct{}
+
+// A requestEscaper holds the Escaper for a request that is handled by
+// Middleware. The Escaper is created when it is first requested, so that
+// handlers that don't use it can write other kinds of responses.
+type requestEscaper struct {
+	w       http.ResponseWriter
+	r       *http.Request
+	options []HTTPOption
+	e       *Escaper
+	c       io.Closer
+}
+
+// Middleware returns a handler that makes an Escaper available to next,
+// through FromRequest or FromContext. The Escaper is set up with ForHTTP
+// when it is first requested, and its Closer is closed after next returns.
+func Middleware(next http.Handler) http.Handler {
+	return NewMiddleware()(next)
+}
+
+// NewMiddleware returns a middleware function like Middleware, which passes
+// options to ForHTTP.
+func NewMiddleware(options ...HTTPOption) func(http.Handler) http.Handler {
+	var conf httpConfig
+	for _, o := range options {
+		o(&conf)
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			re := &requestEscaper{w: w, r: r, options: options}
+			defer func() {
+				if conf.errorPage != nil {
+					if v := recover(); v != nil {
+						re.recover(v, conf.errorPage)
+					}
+				}
+				if re.c != nil {
+					re.c.Close()
+				}
+			}()
+			next.ServeHTTP(w, r.WithContext(stdcontext.WithValue(r.Context(), contextKey{}, re)))
+		})
+	}
+}
+
+// recover handles a panic with value v, replacing the page with an error page
+// if none of it has been sent yet.
+func (re *requestEscaper) recover(v interface{}, page func(e *Escaper, v interface{})) {
+	if v == http.ErrAbortHandler {
+		panic(v)
+	}
+	log.Printf("escaper: panic serving %v: %v\n%s", re.r.RemoteAddr, v, debug.Stack())
+	if re.e == nil {
+		re.e, re.c = ForHTTP(re.w, re.r, re.options...)
+	}
+	if re.e.Discard() != nil {
+		// Part of the page has already been sent, so the best we can do
+		// is to abort the response.
+		re.c.Close()
+		panic(http.ErrAbortHandler)
+	}
+	re.e.Status(http.StatusInternalServerError)
+	page(re.e, v)
+}
+
+// RecoverPanics makes the handler from NewMiddleware recover from panics
+// while the page is being rendered. The panic is logged, and the page is
+// replaced with an error page, written by calling page with a fresh Escaper
+// and the value passed to panic. If page is nil, a plain error page is
+// used.
+//
+// The page can only be replaced if none of it has been sent yet, so
+// RecoverPanics is usually combined with DeferHeaders or Buffered. If the
+// response has already started, it is aborted instead. RecoverPanics has no
+// effect on ForHTTP itself.
+func RecoverPanics(page func(e *Escaper, v interface{})) HTTPOption {
+	if page == nil {
+		page = defaultErrorPage
+	}
+	return func(c *httpConfig) {
+		c.errorPage = page
+	}
+}
+
+// defaultErrorPage is the error page for RecoverPanics.
+func defaultErrorPage(e *Escaper, v interface{}) {
+	e.Literal("<!DOCTYPE html><title>Internal Server Error</title><h1>Internal Server Error</h1>")
+}
+
+// FromRequest returns the Escaper for a request that is being handled with
+// Middleware, or nil if Middleware is not being used.
+func FromRequest(r *http.Request) *Escaper {
+	return FromContext(r.Context())
+}
+
+// FromContext returns the Escaper for the request whose context is ctx, or
+// nil if the request is not being handled with Middleware.
+func FromContext(ctx stdcontext.Context) *Escaper {
+	re, ok := ctx.Value(contextKey{}).(*requestEscaper)
+	if !ok {
+		return nil
+	}
+	if re.e == nil {
+		re.e, re.c = ForHTTP(re.w, re.r, re.options...)
+	}
+	return re.e
+}
@@ -0,0 +1,179 @@
+package escaper
+
+import (
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+func TestMiddleware(t *testing.T) {
+	tests := []struct {
+		name     string
+		handler  http.HandlerFunc
+		encoding string
+		want     string
+	}{
+		{
+			"Escaper",
+			func(w http.ResponseWriter, r *http.Request) {
+				e := FromRequest(r)
+				e.Print("<p>", "a<b", "</p>")
+				if FromContext(r.Context()) != e {
+					t.Error("FromContext returned a different Escaper")
+				}
+			},
+			"gzip",
+			"<p>a&lt;b</p>",
+		},
+		{
+			"no Escaper",
+			func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "text/plain")
+				w.Write([]byte("plain"))
+			},
+			"",
+			"plain",
+		},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Header.Set("Accept-Encoding", "gzip")
+		w := httptest.NewRecorder()
+		Middleware(tt.handler).ServeHTTP(w, r)
+		if got := w.Header().Get("Content-Encoding"); got != tt.encoding {
+			t.Errorf("%s: Content-Encoding %q, want %q", tt.name, got, tt.encoding)
+		}
+		// decodeBody fails if the compressor wasn't closed.
+		if got := decodeBody(t, w); got != tt.want {
+			t.Errorf("%s: body %q, want %q", tt.name, got, tt.want)
+		}
+	}
+
+	r := httptest.NewRequest("GET", "/", nil)
+	if e := FromRequest(r); e != nil {
+		t.Error("FromRequest without Middleware returned an Escaper")
+	}
+}
+
+func TestNewMiddlewareOptions(t *testing.T) {
+	h := NewMiddleware(NoCompression(), ContentType("image/svg+xml"))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		FromRequest(r).Literal("<svg></svg>")
+	}))
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("Accept-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if got := w.Header().Get("Content-Type"); got != "image/svg+xml" {
+		t.Errorf("Content-Type %q", got)
+	}
+	if got := w.Header().Get("Content-Encoding"); got != "" {
+		t.Errorf("Content-Encoding %q", got)
+	}
+	if got := w.Body.String(); got != "<svg></svg>" {
+		t.Errorf("body %q", got)
+	}
+}
+
+func TestRecoverPanics(t *testing.T) {
+	customPage := func(e *Escaper, v interface{}) {
+		e.Print("<p>Error: ", v, "</p>")
+	}
+	tests := []struct {
+		name      string
+		options   []HTTPOption
+		handler   func(e *Escaper)
+		wantCode  int
+		wantBody  string
+		wantAbort bool
+	}{
+		{
+			"default page",
+			[]HTTPOption{RecoverPanics(nil), DeferHeaders(1000)},
+			func(e *Escaper) {
+				e.Literal("<p>Partial")
+				panic("oops")
+			},
+			500,
+			"<!DOCTYPE html><title>Internal Server Error</title><h1>Internal Server Error</h1>",
+			false,
+		},
+		{
+			"custom page",
+			[]HTTPOption{RecoverPanics(customPage), Buffered()},
+			func(e *Escaper) {
+				e.Literal(`<a href="`)
+				panic("<x>")
+			},
+			500,
+			"<p>Error: &lt;x&gt;</p>",
+			false,
+		},
+		{
+			"before Escaper",
+			[]HTTPOption{RecoverPanics(customPage)},
+			nil,
+			500,
+			"<p>Error: early</p>",
+			false,
+		},
+		{
+			"after Flush",
+			[]HTTPOption{RecoverPanics(nil), DeferHeaders(1000)},
+			func(e *Escaper) {
+				e.Literal("<p>Partial")
+				e.Flush()
+				panic("oops")
+			},
+			200,
+			"<p>Partial",
+			true,
+		},
+	}
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+	for _, tt := range tests {
+		h := NewMiddleware(tt.options...)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if tt.handler == nil {
+				panic("early")
+			}
+			tt.handler(FromRequest(r))
+		}))
+		r := httptest.NewRequest("GET", "/", nil)
+		w := httptest.NewRecorder()
+		aborted := false
+		func() {
+			defer func() {
+				if v := recover(); v != nil {
+					if v != http.ErrAbortHandler {
+						t.Errorf("%s: panic %v", tt.name, v)
+					}
+					aborted = true
+				}
+			}()
+			h.ServeHTTP(w, r)
+		}()
+		if aborted != tt.wantAbort {
+			t.Errorf("%s: aborted = %v, want %v", tt.name, aborted, tt.wantAbort)
+		}
+		if w.Code != tt.wantCode {
+			t.Errorf("%s: status %d, want %d", tt.name, w.Code, tt.wantCode)
+		}
+		if got := w.Body.String(); got != tt.wantBody {
+			t.Errorf("%s: body %q, want %q", tt.name, got, tt.wantBody)
+		}
+	}
+
+	// http.ErrAbortHandler is passed on.
+	h := NewMiddleware(RecoverPanics(nil))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic(http.ErrAbortHandler)
+	}))
+	defer func() {
+		if v := recover(); v != http.ErrAbortHandler {
+			t.Errorf("ErrAbortHandler: got panic %v", v)
+		}
+	}()
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+}
@@ -0,0 +1,159 @@
+package escaper
+
+import "strings"
+
+// DefaultBlockElements is the set of elements that the pretty-printer puts on
+// lines of their own when Escaper.BlockElements is nil.
+var DefaultBlockElements = map[string]bool{
+	"address":    true,
+	"article":    true,
+	"aside":      true,
+	"blockquote": true,
+	"body":       true,
+	"dd":         true,
+	"details":    true,
+	"dialog":     true,
+	"div":        true,
+	"dl":         true,
+	"dt":         true,
+	"fieldset":   true,
+	"figcaption": true,
+	"figure":     true,
+	"footer":     true,
+	"form":       true,
+	"h1":         true,
+	"h2":         true,
+	"h3":         true,
+	"h4":         true,
+	"h5":         true,
+	"h6":         true,
+	"head":       true,
+	"header":     true,
+	"hgroup":     true,
+	"hr":         true,
+	"html":       true,
+	"li":         true,
+	"link":       true,
+	"main":       true,
+	"meta":       true,
+	"nav":        true,
+	"ol":         true,
+	"p":          true,
+	"pre":        true,
+	"script":     true,
+	"section":    true,
+	"style":      true,
+	"table":      true,
+	"tbody":      true,
+	"td":         true,
+	"tfoot":      true,
+	"th":         true,
+	"thead":      true,
+	"title":      true,
+	"tr":         true,
+	"ul":         true,
+}
+
+// prettyState is the state of the pretty-printer.
+type prettyState struct {
+	// depth is the number of open block elements.
+	depth int
+	// preDepth is the number of open pre elements, whose content must
+	// not be changed.
+	preDepth int
+	// afterBlock is true if nothing but white space has been written since
+	// the last block element tag.
+	afterBlock bool
+	// started is true once some output has been written.
+	started bool
+}
+
+// isBlock reports whether the pretty-printer treats the element named name
+// as a block element.
+func (e *Escaper) isBlock(name string) bool {
+	if e.BlockElements == nil {
+		return DefaultBlockElements[name]
+	}
+	return e.BlockElements[name]
+}
+
+// prettyPrint updates the output of Literal for pretty-printing, after the
+// piece s[i:i+n] has been parsed in context c0. out holds the output for
+// s[:written]; it returns the updated out and written.
+func (e *Escaper) prettyPrint(c0 context, tagEnd bool, out []byte, s string, written, i, n int) ([]byte, int) {
+	piece := s[i : i+n]
+	if piece == "" {
+		return out, written
+	}
+	p := &e.pretty
+	defer func() { p.started = true }()
+
+	if tagEnd {
+		if e.tag.name == "pre" && !e.tag.end {
+			p.preDepth++
+		}
+		p.afterBlock = e.isBlock(e.tag.name)
+		return out, written
+	}
+	if c0.state != stateText {
+		if !isInTag(c0.state) && c0.state != stateTagOpen && c0.state != stateEndTagOpen && strings.TrimLeft(piece, " \t\n\f\r") != "" {
+			// The content of an element like title or script.
+			p.afterBlock = false
+		}
+		return out, written
+	}
+
+	text := piece
+	lt := -1
+	if e.ctx.state == stateTag {
+		// A tag starts in this piece.
+		lt = strings.LastIndexByte(piece, '<')
+		text = piece[:lt]
+	}
+	if strings.TrimLeft(text, " \t\n\f\r") != "" {
+		p.afterBlock = false
+	}
+	if lt == -1 {
+		return out, written
+	}
+	lt += i
+
+	if p.preDepth > 0 {
+		if e.tag.name == "pre" && e.tag.end {
+			p.preDepth--
+			p.depth--
+		}
+		return out, written
+	}
+	if !e.isBlock(e.tag.name) {
+		p.afterBlock = false
+		return out, written
+	}
+
+	depth := p.depth
+	if e.tag.end {
+		if p.depth > 0 {
+			p.depth--
+		}
+		depth = p.depth
+		if !p.afterBlock {
+			// Don't add white space after inline content at the end of
+			// a block.
+			return out, written
+		}
+	} else if !voidElements[e.tag.name] {
+		p.depth++
+	}
+
+	out = append(out, s[written:lt]...)
+	if p.afterBlock {
+		for len(out) > 0 && strings.IndexByte(" \t\n\f\r", out[len(out)-1]) >= 0 {
+			out = out[:len(out)-1]
+		}
+	}
+	if p.started || len(out) > 0 {
+		out = append(out, '\n')
+		out = append(out, strings.Repeat(e.Indent, depth)...)
+	}
+	return out, lt
+}
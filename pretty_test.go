@@ -0,0 +1,74 @@
+package escaper
+
+import "testing"
+
+func TestIndent(t *testing.T) {
+	tests := []struct {
+		name   string
+		blocks map[string]bool
+		args   []interface{}
+		want   string
+	}{
+		{
+			"blocks",
+			nil,
+			[]interface{}{"<div><section><p>Hi</p></section></div>"},
+			"<div>\n  <section>\n    <p>Hi</p>\n  </section>\n</div>",
+		},
+		{
+			"inline",
+			nil,
+			[]interface{}{`<div><p>a <a href="/">link</a> and <span>b</span>.</p></div>`},
+			"<div>\n  <p>a <a href=\"/\">link</a> and <span>b</span>.</p>\n</div>",
+		},
+		{
+			"existing white space",
+			nil,
+			[]interface{}{"<div>\n\t\t<p>x</p>\n</div>"},
+			"<div>\n  <p>x</p>\n</div>",
+		},
+		{
+			"values",
+			nil,
+			[]interface{}{"<ul><li>", "<a>", "</li><li>", "b", "</li></ul>"},
+			"<ul>\n  <li>&lt;a&gt;</li>\n  <li>b</li>\n</ul>",
+		},
+		{
+			"void",
+			nil,
+			[]interface{}{"<div><hr><p>x</p></div>"},
+			"<div>\n  <hr>\n  <p>x</p>\n</div>",
+		},
+		{
+			"pre",
+			nil,
+			[]interface{}{"<div><pre>  <div>x</div>\n</pre><p>y</p></div>"},
+			"<div>\n  <pre>  <div>x</div>\n</pre>\n  <p>y</p>\n</div>",
+		},
+		{
+			"custom",
+			map[string]bool{"span": true},
+			[]interface{}{"<div><span>a</span><p>b</p></div>"},
+			"<div>\n<span>a</span><p>b</p></div>",
+		},
+		{
+			"custom nested",
+			map[string]bool{"x-card": true},
+			[]interface{}{"<x-card><x-card>a</x-card></x-card>"},
+			"<x-card>\n  <x-card>a</x-card>\n</x-card>",
+		},
+	}
+	for _, tt := range tests {
+		got, err := render(func(e *Escaper) {
+			e.Indent = "  "
+			e.BlockElements = tt.blocks
+		}, tt.args...)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%s:\ngot  %q\nwant %q", tt.name, got, tt.want)
+		}
+	}
+}
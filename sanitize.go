@@ -0,0 +1,180 @@
+package escaper
+
+import (
+	"html"
+	"strings"
+)
+
+// sanitizeState is the state of the sanitizer that is turned on by
+// Escaper.AllowedTags.
+type sanitizeState struct {
+	// drop is true while a tag that is not allowed, the content of such an
+	// element if it is not HTML (as in a script), or a comment or CDATA
+	// section is being dropped.
+	drop bool
+	// dropAttr is true while an attribute that is not allowed is being
+	// dropped.
+	dropAttr bool
+	// pending is a "<" or "</" at the end of a literal, which is held back
+	// until it is known whether the tag it starts is allowed.
+	pending string
+	// url is the part of a URL attribute value that has been written so
+	// far. It is held back until the attribute ends, so that the whole URL
+	// can be checked.
+	url string
+}
+
+// isDangerousAttr reports whether the sanitizer drops the named attribute:
+// event handlers, style, and srcdoc.
+func isDangerousAttr(name string) bool {
+	switch attrType(name) {
+	case contentTypeJS, contentTypeCSS, contentTypeHTML:
+		return true
+	}
+	return false
+}
+
+// rawTextElements is the set of elements that the sanitizer drops even if
+// they are in AllowedTags. Browsers parse their content as raw text (in the
+// case of noscript, when scripting is enabled), but Literal parses it as HTML,
+// so an attribute value that looks harmless to the sanitizer could end the
+// element and start a tag with an event handler.
+var rawTextElements = map[string]bool{
+	"iframe":    true,
+	"noembed":   true,
+	"noframes":  true,
+	"noscript":  true,
+	"plaintext": true,
+	"xmp":       true,
+}
+
+// tagAllowed reports whether the sanitizer keeps tags with the given
+// (lowercase) name.
+func (e *Escaper) tagAllowed(name string) bool {
+	return e.AllowedTags[name] && !rawTextElements[name]
+}
+
+// sanitize updates the output of Literal to drop disallowed markup, after the
+// piece s[i:i+n] has been parsed in context c0. out holds the output for
+// s[:written]; it returns the updated out and written, and whether the piece
+// was dropped.
+func (e *Escaper) sanitize(c0 context, out []byte, s string, written, i, n int) ([]byte, int, bool) {
+	p := &e.san
+	c1 := e.ctx
+	piece := s[i : i+n]
+	tagStart := c1.state == stateTag && (c0.state == stateText || c0.state == stateTagOpen || c0.state == stateEndTagOpen)
+
+	if c0.state == stateTagOpen || c0.state == stateEndTagOpen {
+		switch {
+		case c1.state == stateEndTagOpen:
+			// "<" followed by "/"; keep waiting for the tag name.
+			p.pending = "</"
+			return append(out, s[written:i]...), i + n, true
+		case c1.state == stateHTMLCmt || c1.state == stateBogusCmt || c1.state == stateCDATA:
+			// The "<" is dropped along with the comment.
+		case !tagStart || e.tagAllowed(e.tag.name):
+			out = append(out, p.pending...)
+		}
+		p.pending = ""
+	}
+	if c0.state == stateTag {
+		p.dropAttr = false
+	}
+
+	start := -1
+	switch {
+	case p.drop || p.dropAttr:
+		start = i
+	case tagStart && !e.tagAllowed(e.tag.name):
+		start = i
+		if c0.state == stateText {
+			start += strings.LastIndexByte(piece, '<')
+		}
+		p.drop = true
+	case c1.state != c0.state && (c1.state == stateHTMLCmt || c1.state == stateBogusCmt || c1.state == stateCDATA):
+		// CDATA sections are dropped too, in case the browser doesn't
+		// see them as being in foreign content.
+		start = i
+		if c0.state == stateText {
+			start += strings.LastIndexByte(piece, '<')
+		}
+		p.drop = true
+	case c0.state == stateText && (c1.state == stateTagOpen || c1.state == stateEndTagOpen):
+		lt := i + strings.LastIndexByte(piece, '<')
+		p.pending = "<"
+		if c1.state == stateEndTagOpen {
+			p.pending = "</"
+		}
+		return append(out, s[written:lt]...), i + n, false
+	case c0.state == stateTag && (c1.state == stateAttrName || c1.state == stateAfterName):
+		if isDangerousAttr(piece[eatWhiteSpaceAndSlashes(piece, 0):]) {
+			start = i
+			p.dropAttr = true
+		}
+	case c0.state == stateURL && c0.delim != delimNone:
+		// The URL may be split between several calls to Literal and
+		// Value, so it is held back until the attribute ends.
+		out = append(out, s[written:i]...)
+		if c1.state == stateURL {
+			p.url += piece
+			if e.borrowed {
+				// The URL is kept after the call, so it must not
+				// share memory with the caller's byte slice.
+				p.url = string([]byte(p.url))
+			}
+			return out, i + n, true
+		}
+		url, end := p.url+piece, ""
+		if c0.delim != delimSpaceOrTagEnd {
+			// Leave the closing quote.
+			url, end = url[:len(url)-1], piece[n-1:]
+		}
+		p.url = ""
+		policy := e.urlPolicy()
+		if policy == nil {
+			policy = DefaultURLPolicy
+		}
+		if _, ok := policy(html.UnescapeString(url), URLContext{Element: e.tag.name, Attr: e.tag.attr}); !ok {
+			url = e.failsafeFor("#" + filterFailsafe)
+		}
+		out = append(out, url...)
+		return append(out, end...), i + n, true
+	}
+
+	if p.drop && c1.state == stateText {
+		p.drop = false
+	}
+	if start == -1 {
+		return out, written, false
+	}
+	return append(out, s[written:start]...), i + n, true
+}
+
+// stripComment drops the piece s[i:i+n], which was parsed in context c0, if it
+// is part of an HTML comment, for Escaper.StripComments. out holds the output
+// for s[:written]; it returns the updated out and written, and whether the
+// piece was dropped.
+func (e *Escaper) stripComment(c0 context, out []byte, s string, written, i, n int) ([]byte, int, bool) {
+	piece := s[i : i+n]
+	switch {
+	case c0.state == stateHTMLCmt:
+		if !e.stripping {
+			return out, written, false
+		}
+		if e.ctx.state != stateHTMLCmt {
+			e.stripping = false
+		}
+	case e.ctx.state == stateHTMLCmt:
+		lt := strings.LastIndexByte(piece, '<')
+		if lt == -1 {
+			// The "<" was written by an earlier call to Literal,
+			// so the comment has to be kept.
+			return out, written, false
+		}
+		e.stripping = true
+		return append(out, s[written:i+lt]...), i + n, true
+	default:
+		return out, written, false
+	}
+	return append(out, s[written:i]...), i + n, true
+}
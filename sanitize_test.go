@@ -0,0 +1,172 @@
+package escaper
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSanitizeSplitURL(t *testing.T) {
+	tests := []struct {
+		name string
+		args []interface{}
+		want string
+	}{
+		{
+			"one literal",
+			[]interface{}{`<a href="javascript:alert(1)">x</a>`},
+			`<a href="#ZgotmplZ">x</a>`,
+		},
+		{
+			"split between literals",
+			[]interface{}{`<a href="java`, "", `script:alert(1)">x</a>`},
+			`<a href="#ZgotmplZ">x</a>`,
+		},
+		{
+			"split around a value",
+			[]interface{}{`<a href="java`, "script", `:alert(1)">x</a>`},
+			`<a href="#ZgotmplZ">x</a>`,
+		},
+		{
+			"unquoted",
+			[]interface{}{`<a href=java`, "", `script:alert(1)>x</a>`},
+			`<a href=#ZgotmplZ>x</a>`,
+		},
+		{
+			"safe URL",
+			[]interface{}{`<a href="/search?q=`, "a b", `&amp;n=1">x</a>`},
+			`<a href="/search?q=a%20b&amp;n=1">x</a>`,
+		},
+	}
+	for _, tt := range tests {
+		got, err := render(func(e *Escaper) {
+			e.AllowedTags = map[string]bool{"a": true}
+		}, tt.args...)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestSanitize(t *testing.T) {
+	tests := []struct {
+		name string
+		html string
+		want string
+	}{
+		{"allowed", "<p>Hello <b>world</b></p>", "<p>Hello <b>world</b></p>"},
+		{"unknown tags", "<p>Hello <blink>world</blink><x-y>!</x-y></p>", "<p>Hello world!</p>"},
+		{"upper case", "<P>a<B>b</B></P>", "<P>a<B>b</B></P>"},
+		{"script", "<p>a<script>alert(1)</script>b</p>", "<p>ab</p>"},
+		{"style", "<style>p { color: red }</style><p>x</p>", "<p>x</p>"},
+		{"comment", "<p>a<!-- secret -->b</p>", "<p>ab</p>"},
+		{"event handler", `<p onclick="alert(1)" title="t">x</p>`, `<p title="t">x</p>`},
+		{"style attribute", `<p style="color: red">x</p>`, `<p>x</p>`},
+		{"javascript URL", `<a href="javascript:alert(1)">x</a>`, `<a href="#ZgotmplZ">x</a>`},
+		{"safe URL", `<a href="https://example.com/">x</a>`, `<a href="https://example.com/">x</a>`},
+		{"iframe srcdoc", `<iframe srcdoc="<script>alert(1)</script>"></iframe>`, ``},
+		{"bogus comment", "<p>a<?php echo 1 ?>b</p>", "<p>ab</p>"},
+		{"doctype", "<!DOCTYPE html><p>x</p>", "<p>x</p>"},
+		{"bogus end tag", "<p>a</ x>b</p>", "<p>ab</p>"},
+		{"noscript", `<noscript><p title="</noscript><img src=x onerror=alert(1)>"></p></noscript>`, `<p title="</noscript><img src=x onerror=alert(1)>"></p>`},
+		{"xmp", `<xmp><p title="</xmp><img src=x onerror=alert(1)>"></p></xmp>`, `<p title="</xmp><img src=x onerror=alert(1)>"></p>`},
+		{"iframe", `<iframe><p title="</iframe><img src=x onerror=alert(1)>"></p></iframe>`, `<p title="</iframe><img src=x onerror=alert(1)>"></p>`},
+	}
+	for _, tt := range tests {
+		got, err := render(func(e *Escaper) {
+			e.AllowedTags = map[string]bool{"p": true, "b": true, "a": true, "noscript": true, "xmp": true, "iframe": true}
+		}, tt.html)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+
+	// Values are escaped as usual.
+	got, err := render(func(e *Escaper) {
+		e.AllowedTags = map[string]bool{"p": true}
+	}, "<p>", "<script>", "</p>")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "<p>&lt;script&gt;</p>"; got != want {
+		t.Errorf("value: got %q, want %q", got, want)
+	}
+}
+
+func TestStripComments(t *testing.T) {
+	tests := []struct {
+		name     string
+		literals []string
+		want     string
+	}{
+		{"comment", []string{"<p>a<!-- x -->b</p>"}, "<p>ab</p>"},
+		{"two comments", []string{"<!-- a --><!-- b -->c"}, "c"},
+		{"empty comment", []string{"a<!---->b"}, "ab"},
+		{"conditional comment", []string{"a<!--[if IE]><b>x</b><![endif]-->b"}, "ab"},
+		{"unclosed", []string{"<p>a<!-- x"}, "<p>a"},
+		{"across literals", []string{"a<!-- x", " y -->b"}, "ab"},
+		{"split start", []string{"a<", "!-- x -->b"}, "a<!-- x -->b"},
+		{"script", []string{"<script>/* x */<!-- y --></script>"}, "<script>/* x */<!-- y --></script>"},
+		{"style", []string{"<style>/* x */</style>"}, "<style>/* x */</style>"},
+		{"attribute", []string{`<a title="<!-- x -->">`}, `<a title="<!-- x -->">`},
+		{"textarea", []string{"<textarea><!-- x --></textarea>"}, "<textarea><!-- x --></textarea>"},
+	}
+	for _, tt := range tests {
+		var b strings.Builder
+		e := New(&b)
+		e.StripComments = true
+		for _, lit := range tt.literals {
+			if err := e.Literal(lit); err != nil {
+				t.Errorf("%s: %v", tt.name, err)
+			}
+		}
+		if got := b.String(); got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+
+	// A value in a stripped comment is dropped with it.
+	got, err := render(func(e *Escaper) { e.StripComments = true }, "<p>a<!-- ", "v", " -->b</p>")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "<p>ab</p>"; got != want {
+		t.Errorf("value: got %q, want %q", got, want)
+	}
+}
+
+func TestSanitizeForeignContent(t *testing.T) {
+	const img = "<img src=x onerror=alert(1)>"
+	tests := []struct {
+		name    string
+		allowed []string
+		html    string
+		want    string
+	}{
+		{"dropped svg", []string{"b"}, "<svg><![CDATA[ >" + img + " ]]></svg>", " ]]>"},
+		{"end p in svg", []string{"svg", "p"}, "<svg></p><![CDATA[ >" + img + " ]]></svg>", "<svg></p> ]]></svg>"},
+		{"end br in svg", []string{"svg", "br"}, "<svg></br><![CDATA[ >" + img + " ]]></svg>", "<svg></br> ]]></svg>"},
+		{"CDATA in svg", []string{"svg"}, "<svg><![CDATA[ >" + img + " ]]></svg>", "<svg></svg>"},
+	}
+	for _, tt := range tests {
+		allowed := map[string]bool{}
+		for _, name := range tt.allowed {
+			allowed[name] = true
+		}
+		got, err := render(func(e *Escaper) { e.AllowedTags = allowed }, tt.html)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
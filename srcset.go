@@ -0,0 +1,41 @@
+package escaper
+
+import (
+	"bytes"
+	"html/template"
+	"strconv"
+	"strings"
+)
+
+// SrcsetFromPattern builds a srcset attribute value with a candidate for each
+// pixel density in densities. The URL for each candidate is pattern with %d
+// replaced by the density. For example,
+//
+//	SrcsetFromPattern("img@%dx.jpg", 1, 2)
+//
+// returns "img@1x.jpg 1x, img@2x.jpg 2x". The URLs are filtered and
+// normalized the same way as values in a srcset attribute.
+func SrcsetFromPattern(pattern string, densities ...int) (template.Srcset, error) {
+	if !strings.Contains(pattern, "%d") {
+		return "", errorf(ErrBadArg, "srcset pattern %q has no %%d", pattern)
+	}
+	var b bytes.Buffer
+	for i, d := range densities {
+		if d <= 0 {
+			return "", errorf(ErrBadArg, "invalid pixel density: %d", d)
+		}
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		u := strings.Replace(pattern, "%d", strconv.Itoa(d), 1)
+		if !isSafeURL(u) {
+			return "", errorf(ErrBadArg, "unsafe URL in srcset: %q", u)
+		}
+		var ub bytes.Buffer
+		processURLOnto(u, true, &ub)
+		// Commas separate one candidate from another.
+		b.WriteString(strings.Replace(ub.String(), ",", "%2C", -1))
+		b.WriteString(" " + strconv.Itoa(d) + "x")
+	}
+	return template.Srcset(b.String()), nil
+}
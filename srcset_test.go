@@ -0,0 +1,114 @@
+package escaper
+
+import (
+	"html/template"
+	"strings"
+	"testing"
+)
+
+func TestSrcsetFailsafe(t *testing.T) {
+	tests := []valueTest{
+		{"second", `<img srcset="`, `">`, "a.png 1x, javascript:x 2x", `<img srcset="a.png 1x, #ZgotmplZ">`},
+		{"first", `<img srcset="`, `">`, "javascript:x 1x,  b.png 2x", `<img srcset="#ZgotmplZ,  b.png 2x">`},
+		{"no space", `<img srcset="`, `">`, "a.png 1x,javascript:x 2x", `<img srcset="a.png 1x,#ZgotmplZ">`},
+	}
+	runValueTests(t, nil, tests)
+
+	for i := range tests {
+		tt := &tests[i]
+		tt.want = strings.Replace(tt.want, "#ZgotmplZ", "blocked.png", -1)
+	}
+	runValueTests(t, func(e *Escaper) { e.SetFailsafe("blocked.png") }, tests)
+}
+
+func TestSrcsetSchemes(t *testing.T) {
+	runValueTests(t, nil, []valueTest{
+		{"javascript", `<img srcset="`, `">`, "javascript:alert(1) 1x", `<img srcset="#ZgotmplZ">`},
+		{"mixed case", `<img srcset="`, `">`, "JavaScript:alert(1) 1x", `<img srcset="#ZgotmplZ">`},
+		{"vbscript", `<img srcset="`, `">`, "a.png 1x, vbscript:x 2x", `<img srcset="a.png 1x, #ZgotmplZ">`},
+		{"ftp", `<img srcset="`, `">`, "ftp://x/a.png 1x, /b.png 2x", `<img srcset="#ZgotmplZ, /b.png 2x">`},
+		{"https", `<img srcset="`, `">`, "https://x/a.png 100w, /b.png 200w", `<img srcset="https://x/a.png 100w, /b.png 200w">`},
+		{"source element", `<source srcset="`, `">`, "javascript:x", `<source srcset="#ZgotmplZ">`},
+	})
+
+	runValueTests(t, func(e *Escaper) { e.URLSchemes = []string{"ftp"} }, []valueTest{
+		{"allowed scheme", `<img srcset="`, `">`, "ftp://x/a.png 1x, javascript:x 2x", `<img srcset="ftp://x/a.png 1x, #ZgotmplZ">`},
+	})
+
+	var seen []URLContext
+	policy := func(e *Escaper) {
+		e.URLPolicy = func(url string, ctx URLContext) (string, bool) {
+			seen = append(seen, ctx)
+			return url, strings.HasPrefix(url, "/img/")
+		}
+	}
+	runValueTests(t, policy, []valueTest{
+		{"URLPolicy", `<img srcset="`, `">`, "/img/a.png 1x, https://x/b.png 2x", `<img srcset="/img/a.png 1x, #ZgotmplZ">`},
+	})
+	for _, ctx := range seen {
+		if !ctx.Srcset || ctx.Element != "img" || ctx.Attr != "srcset" {
+			t.Errorf("URLPolicy called with %+v", ctx)
+		}
+	}
+	if len(seen) != 2 {
+		t.Errorf("URLPolicy called %d times, want 2", len(seen))
+	}
+}
+
+func TestSrcsetFromPattern(t *testing.T) {
+	tests := []struct {
+		pattern   string
+		densities []int
+		want      template.Srcset
+		wantErr   bool
+	}{
+		{"img@%dx.jpg", []int{1, 2}, "img@1x.jpg 1x, img@2x.jpg 2x", false},
+		{"/img/a-%d.png", []int{1, 2, 3}, "/img/a-1.png 1x, /img/a-2.png 2x, /img/a-3.png 3x", false},
+		{"/a b/%d,x.png", []int{1}, "/a%20b/1%2Cx.png 1x", false},
+		{"https://cdn.example.com/%d/a.png", []int{2}, "https://cdn.example.com/2/a.png 2x", false},
+		{"img.jpg", []int{1}, "", true},
+		{"img@%dx.jpg", []int{1, 0}, "", true},
+		{"img@%dx.jpg", []int{-1}, "", true},
+		{"javascript:alert(%d)", []int{1}, "", true},
+	}
+	for _, tt := range tests {
+		got, err := SrcsetFromPattern(tt.pattern, tt.densities...)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("SrcsetFromPattern(%q, %v): no error", tt.pattern, tt.densities)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("SrcsetFromPattern(%q, %v): %v", tt.pattern, tt.densities, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("SrcsetFromPattern(%q, %v) = %q, want %q", tt.pattern, tt.densities, got, tt.want)
+		}
+	}
+
+	s, _ := SrcsetFromPattern("img@%dx.jpg", 1, 2)
+	runValueTests(t, nil, []valueTest{
+		{"in srcset", `<img srcset="`, `">`, s, `<img srcset="img@1x.jpg 1x, img@2x.jpg 2x">`},
+	})
+}
+
+func TestSrcsetDescriptors(t *testing.T) {
+	runValueTests(t, nil, []valueTest{
+		{"density", `<img srcset="`, `">`, "a.png 2x, b.png 1x", `<img srcset="a.png 2x, b.png 1x">`},
+		{"fractional density", `<img srcset="`, `">`, "a.png 1.5x, b.png .5x", `<img srcset="a.png 1.5x, b.png .5x">`},
+		{"width and height", `<img srcset="`, `">`, "a.png 100w 50h", `<img srcset="a.png 100w 50h">`},
+		{"no descriptor", `<img srcset="`, `">`, "a.png", `<img srcset="a.png">`},
+		{"URL normalized", `<img srcset="`, `">`, "a b.png 1x", `<img srcset="#ZgotmplZ">`},
+		{"quote in URL", `<img srcset="`, `">`, `a".png 1x`, `<img srcset="a%22.png 1x">`},
+		{"fractional width", `<img srcset="`, `">`, "a.png 1.5w", `<img srcset="#ZgotmplZ">`},
+		{"lone dot", `<img srcset="`, `">`, "a.png .x", `<img srcset="#ZgotmplZ">`},
+		{"two dots", `<img srcset="`, `">`, "a.png 1.5.2x", `<img srcset="#ZgotmplZ">`},
+		{"bad unit", `<img srcset="`, `">`, "a.png 2y", `<img srcset="#ZgotmplZ">`},
+		{"markup in descriptor", `<img srcset="`, `">`, `a.png 1x"onerror=x`, `<img srcset="#ZgotmplZ">`},
+		{"separate values", `<img srcset="`, ` 2x, /b.png 1x">`, "/a.png", `<img srcset="/a.png 2x, /b.png 1x">`},
+		{"trusted srcset", `<img srcset="`, `">`, template.Srcset("a.png 1x, b.png q"), `<img srcset="a.png 1x, b.png q">`},
+		{"trusted URL", `<img srcset="`, ` 1x">`, template.URL("a,b.png"), `<img srcset="a%2Cb.png 1x">`},
+	})
+}
@@ -0,0 +1,75 @@
+package escaper
+
+import (
+	"bytes"
+	"net/http"
+	"strings"
+)
+
+// ForSSE returns an Escaper for a Server-Sent Events (text/event-stream)
+// response, for sending fragments of HTML to a page as they change. The
+// output of the Escaper is held until Send is called on the returned
+// EventStream, which sends it as a single event. Once the client disconnects
+// (and r's context is canceled), Send returns the context's error.
+func ForSSE(w http.ResponseWriter, r *http.Request) (*Escaper, *EventStream) {
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	if f, ok := w.(http.Flusher); ok {
+		f.Flush()
+	}
+	s := &EventStream{w: w, r: r}
+	s.e = New(&s.buf)
+	return s.e, s
+}
+
+// An EventStream sends the output of an Escaper from ForSSE as events.
+type EventStream struct {
+	w   http.ResponseWriter
+	r   *http.Request
+	e   *Escaper
+	buf bytes.Buffer
+}
+
+// Send sends the HTML that has been written since the last call to Send as an
+// event. If event is not empty, it is used as the event's type; otherwise
+// the browser treats it as a message event. Each line of the HTML is sent
+// as a data: line, and the response is flushed after the event.
+//
+// Each event must be a complete fragment of HTML, so Send returns an error,
+// without sending anything, if the Escaper is not in HTML text, as with
+// Finish. If the request's context has been canceled, because the client has
+// disconnected, Send returns the context's error, so that the caller can stop
+// producing events.
+func (s *EventStream) Send(event string) error {
+	if strings.ContainsAny(event, "\r\n") {
+		return errorf(ErrBadArg, "invalid event type: %q", event)
+	}
+	if err := s.r.Context().Err(); err != nil {
+		s.buf.Reset()
+		return err
+	}
+	if err := s.e.Finish(); err != nil {
+		return err
+	}
+
+	var b bytes.Buffer
+	if event != "" {
+		b.WriteString("event: " + event + "\n")
+	}
+	data := strings.Replace(s.buf.String(), "\r\n", "\n", -1)
+	data = strings.Replace(data, "\r", "\n", -1)
+	for _, line := range strings.Split(data, "\n") {
+		b.WriteString("data: " + line + "\n")
+	}
+	b.WriteString("\n")
+	s.buf.Reset()
+
+	if _, err := s.w.Write(b.Bytes()); err != nil {
+		return err
+	}
+	if f, ok := s.w.(http.Flusher); ok {
+		f.Flush()
+	}
+	return nil
+}
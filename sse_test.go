@@ -0,0 +1,41 @@
+package escaper
+
+import (
+	stdcontext "context"
+	"errors"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestEventStream(t *testing.T) {
+	ctx, cancel := stdcontext.WithCancel(stdcontext.Background())
+	defer cancel()
+	r := httptest.NewRequest("GET", "/events", nil).WithContext(ctx)
+	w := httptest.NewRecorder()
+	e, s := ForSSE(w, r)
+
+	e.Print("<p>", "a<b", "</p>\n<p>2</p>")
+	if err := s.Send("update"); err != nil {
+		t.Fatal(err)
+	}
+	want := "event: update\ndata: <p>a&lt;b</p>\ndata: <p>2</p>\n\n"
+	if got := w.Body.String(); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if got := w.Header().Get("Content-Type"); got != "text/event-stream" {
+		t.Errorf("Content-Type is %q", got)
+	}
+
+	if err := s.Send("bad\nname"); !errors.Is(err, ErrBadArg) {
+		t.Errorf("invalid event name: got %v", err)
+	}
+
+	cancel()
+	e.Literal("<p>3</p>")
+	if err := s.Send(""); err != stdcontext.Canceled {
+		t.Errorf("after cancel: got %v, want %v", err, stdcontext.Canceled)
+	}
+	if got := w.Body.String(); got != want {
+		t.Errorf("after cancel: got %q", got)
+	}
+}
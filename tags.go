@@ -0,0 +1,444 @@
+package escaper
+
+import (
+	"html"
+	"strings"
+)
+
+// tagInfo holds information about the tag that an Escaper is parsing (or has
+// parsed most recently), for features that need more than the escaping
+// context.
+type tagInfo struct {
+	// name is the lowercase tag name.
+	name string
+	// end is true for an end tag.
+	end bool
+	// attrs is the number of attributes seen so far.
+	attrs int
+	// attr is the lowercase name of the attribute that was started most
+	// recently by literal HTML, until the end of the tag.
+	attr string
+
+	// slash is true if the last thing in the tag was a slash, as in "<br/".
+	slash bool
+	// slashAt is the index of that slash in the string being processed by
+	// Literal, or -1 if it was written by an earlier call.
+	slashAt int
+
+	// afterUnquoted is true if an unquoted attribute value has just ended,
+	// without any white space after it.
+	afterUnquoted bool
+
+	// dropsNewline is true right after the start tag of an element whose
+	// first newline is dropped by HTML parsers.
+	dropsNewline bool
+
+	// foreign is a stack of the open elements that change how HTML is
+	// parsed, one byte for each, from foreignElements.
+	foreign string
+
+	// inEncoding is true in the encoding attribute of an annotation-xml
+	// element, and htmlEncoding is true if that attribute says that the
+	// element contains HTML.
+	inEncoding   bool
+	htmlEncoding bool
+
+	// templates is the number of open template elements. Their content
+	// is parsed and escaped like any other HTML, even though browsers
+	// don't render it.
+	templates int
+}
+
+// trackTag updates e.tag after Literal has parsed piece, which started at
+// offset in the string passed to Literal, in context c0. It reports whether
+// piece ended a tag; if so, its last byte is the '>'.
+func (e *Escaper) trackTag(c0 context, piece string, offset int) (tagEnd bool) {
+	c1 := e.ctx
+	if piece != "" {
+		e.tag.dropsNewline = false
+	}
+	switch c0.state {
+	case stateText, stateTagOpen, stateEndTagOpen:
+		if c1.state == stateCDATA && !e.inForeignContent() {
+			e.ctx = context{state: stateBogusCmt}
+		}
+		if c1.state != stateTag {
+			return false
+		}
+		// A new tag has started.
+		name := piece
+		if c0.state == stateText {
+			name = piece[strings.LastIndexByte(piece, '<')+1:]
+		}
+		end := c0.state == stateEndTagOpen
+		if strings.HasPrefix(name, "/") {
+			name, end = name[1:], true
+		}
+		name = strings.ToLower(name)
+		if e.borrowed {
+			// The name is kept after the call, so it must not share
+			// memory with the caller's byte slice.
+			name = string([]byte(name))
+		}
+		e.tag = tagInfo{name: name, end: end, slashAt: -1, foreign: e.tag.foreign, templates: e.tag.templates}
+
+	case stateTag:
+		afterUnquoted := e.tag.afterUnquoted
+		e.tag.afterUnquoted = false
+		tagEnd = !isInTag(c1.state) && c1.state != stateError
+		body := piece
+		if tagEnd {
+			e.tag.attr = ""
+			body = piece[:len(piece)-1]
+			e.tag.afterUnquoted = afterUnquoted && body == ""
+			e.tag.dropsNewline = !e.tag.end && newlineDroppingElements[e.tag.name]
+		}
+		if c1.state == stateAttrName || c1.state == stateAfterName {
+			e.tag.attr = strings.ToLower(piece[eatWhiteSpaceAndSlashes(piece, 0):])
+			if e.borrowed {
+				e.tag.attr = string([]byte(e.tag.attr))
+			}
+			e.countAttr()
+			if e.tag.name == "annotation-xml" {
+				e.tag.inEncoding = strings.EqualFold(piece[eatWhiteSpaceAndSlashes(piece, 0):], "encoding")
+			}
+		}
+		if body != "" {
+			// A slash is only self-closing if it comes right before
+			// the '>'; otherwise it is treated like white space.
+			e.tag.slash = strings.HasSuffix(body, "/")
+			if e.tag.slash {
+				e.tag.slashAt = offset + len(body) - 1
+			}
+		}
+		if tagEnd && e.CheckTagBalance {
+			e.balanceTag()
+		}
+		if tagEnd {
+			if e.tag.name == "template" && !e.inForeignContent() {
+				switch {
+				case e.tag.end && e.tag.templates > 0:
+					e.tag.templates--
+				case !e.tag.end:
+					e.tag.templates++
+				}
+			}
+			if e.AllowedTags == nil || e.tagAllowed(e.tag.name) {
+				// A tag that the sanitizer drops doesn't
+				// change how the browser parses what follows.
+				e.trackForeign()
+			}
+		}
+		return tagEnd
+
+	default:
+		if c0.delim == delimSpaceOrTagEnd && c1.state == stateTag {
+			e.tag.afterUnquoted = true
+		}
+		if e.tag.inEncoding && c0.delim != delimNone && c1.state == stateTag {
+			// The value of the encoding attribute has ended. Only a
+			// value that was written as a literal is recognized.
+			v := piece
+			if c0.delim != delimSpaceOrTagEnd {
+				v = v[:len(v)-1]
+			}
+			switch strings.ToLower(strings.TrimSpace(html.UnescapeString(v))) {
+			case "text/html", "application/xhtml+xml":
+				e.tag.htmlEncoding = true
+			}
+			e.tag.inEncoding = false
+		}
+	}
+	return false
+}
+
+// countAttr records the start of an attribute in the current tag.
+func (e *Escaper) countAttr() {
+	e.tag.attrs++
+	if e.tag.attrs == e.MaxAttributes+1 && e.MaxAttributes > 0 && e.Warn != nil {
+		e.Warn(errorf(ErrAttrCount, "<%s> has more than %d attributes", e.tag.name, e.MaxAttributes))
+	}
+}
+
+// newlineDroppingElements is the set of elements whose content loses a
+// newline right after the start tag when it is parsed.
+var newlineDroppingElements = map[string]bool{
+	"listing":  true,
+	"pre":      true,
+	"textarea": true,
+}
+
+// voidElements is the set of HTML elements that have no content and no end
+// tag.
+var voidElements = map[string]bool{
+	"area":   true,
+	"base":   true,
+	"br":     true,
+	"col":    true,
+	"embed":  true,
+	"hr":     true,
+	"img":    true,
+	"input":  true,
+	"link":   true,
+	"meta":   true,
+	"param":  true,
+	"source": true,
+	"track":  true,
+	"wbr":    true,
+}
+
+// normalizeVoid rewrites the end of a void element's start tag, whose '>' is
+// at s[k], to match e.XHTML (or e.XML). out holds the output for s[:written];
+// it returns the updated out and written. A slash that was written by an
+// earlier call to Literal can't be removed.
+func (e *Escaper) normalizeVoid(out []byte, s string, written, k int) ([]byte, int) {
+	if e.tag.end || !voidElements[e.tag.name] {
+		return out, written
+	}
+	xhtml := e.XHTML || e.XML
+	switch {
+	case !xhtml && e.tag.slashAt >= written:
+		out = append(out, s[written:e.tag.slashAt]...)
+		for len(out) > 0 && strings.IndexByte(" \t\n\f\r", out[len(out)-1]) >= 0 {
+			out = out[:len(out)-1]
+		}
+		return out, e.tag.slashAt + 1
+	case xhtml && !e.tag.slash:
+		out = append(out, s[written:k]...)
+		if e.tag.afterUnquoted {
+			// Keep the slash from becoming part of the value.
+			out = append(out, ' ')
+		}
+		return append(out, '/'), k
+	}
+	return out, written
+}
+
+// addNonce adds a nonce attribute at s[k], if it is right after the name of a
+// script or style start tag, which started in context c0. out holds the output
+// for s[:written]; it returns the updated out and written.
+func (e *Escaper) addNonce(c0 context, out []byte, s string, written, k int) ([]byte, int) {
+	if e.ctx.state != stateTag || !(c0.state == stateText || c0.state == stateTagOpen) || e.tag.end {
+		return out, written
+	}
+	if e.tag.name != "script" && e.tag.name != "style" {
+		return out, written
+	}
+	out = append(out, s[written:k]...)
+	out = append(out, ` nonce="`...)
+	out = append(out, htmlEscaper(e.Nonce)...)
+	return append(out, '"'), k
+}
+
+// optionalEndTags is the set of elements whose end tags may be omitted.
+var optionalEndTags = map[string]bool{
+	"body":     true,
+	"caption":  true,
+	"colgroup": true,
+	"dd":       true,
+	"dt":       true,
+	"head":     true,
+	"html":     true,
+	"li":       true,
+	"optgroup": true,
+	"option":   true,
+	"p":        true,
+	"rp":       true,
+	"rt":       true,
+	"tbody":    true,
+	"td":       true,
+	"tfoot":    true,
+	"th":       true,
+	"thead":    true,
+	"tr":       true,
+}
+
+// balanceTag updates e.open for the tag that has just ended.
+func (e *Escaper) balanceTag() {
+	name := e.tag.name
+	if !e.tag.end {
+		if !voidElements[name] && !e.tag.slash {
+			e.open = append(e.open, name)
+		}
+		return
+	}
+	for i := len(e.open) - 1; i >= 0; i-- {
+		if e.open[i] == name {
+			// Elements between this one and its end tag are closed
+			// implicitly; the ones that need end tags are reported
+			// when Finish is called.
+			for _, el := range e.open[i+1:] {
+				if !optionalEndTags[el] {
+					e.unclosed = append(e.unclosed, el)
+				}
+			}
+			e.open = e.open[:i]
+			return
+		}
+	}
+}
+
+// unclosedElements returns the elements that were not closed properly.
+func (e *Escaper) unclosedElements() []string {
+	list := append([]string(nil), e.unclosed...)
+	for _, el := range e.open {
+		if !optionalEndTags[el] {
+			list = append(list, el)
+		}
+	}
+	return list
+}
+
+// inForeignContent reports whether the tags being parsed are in foreign
+// content (inside an svg or math element), where they are parsed by XML-like
+// rules.
+func (e *Escaper) inForeignContent() bool {
+	f := e.tag.foreign
+	return f != "" && strings.IndexByte(foreignContent, f[len(f)-1]) != -1
+}
+
+// foreignElements maps the elements that are tracked in tagInfo.foreign to
+// the bytes that can stand for them there. For annotation-xml, 'x' is used
+// for MathML content, and 'A' for HTML content.
+var foreignElements = map[string]string{
+	"svg":            "s",
+	"math":           "m",
+	"annotation-xml": "xA",
+
+	// HTML integration points in SVG.
+	"desc":          "d",
+	"foreignobject": "f",
+	"title":         "t",
+
+	// MathML text integration points.
+	"mi":    "I",
+	"mn":    "N",
+	"mo":    "O",
+	"ms":    "S",
+	"mtext": "T",
+}
+
+// foreignContent is the set of bytes in tagInfo.foreign that stand for
+// elements whose content is foreign content.
+const foreignContent = "smx"
+
+// breakoutElements is the set of HTML elements whose start tags end foreign
+// content. (Font only does so if it has a color, face, or size attribute, but
+// it is always treated as HTML, which is the safe assumption.)
+var breakoutElements = map[string]bool{
+	"b":          true,
+	"big":        true,
+	"blockquote": true,
+	"body":       true,
+	"br":         true,
+	"center":     true,
+	"code":       true,
+	"dd":         true,
+	"div":        true,
+	"dl":         true,
+	"dt":         true,
+	"em":         true,
+	"embed":      true,
+	"font":       true,
+	"h1":         true,
+	"h2":         true,
+	"h3":         true,
+	"h4":         true,
+	"h5":         true,
+	"h6":         true,
+	"head":       true,
+	"hr":         true,
+	"i":          true,
+	"img":        true,
+	"li":         true,
+	"listing":    true,
+	"menu":       true,
+	"meta":       true,
+	"nobr":       true,
+	"ol":         true,
+	"p":          true,
+	"pre":        true,
+	"ruby":       true,
+	"s":          true,
+	"small":      true,
+	"span":       true,
+	"strike":     true,
+	"strong":     true,
+	"sub":        true,
+	"sup":        true,
+	"table":      true,
+	"tt":         true,
+	"u":          true,
+	"ul":         true,
+	"var":        true,
+}
+
+// trackForeign updates e.tag.foreign after a tag has ended, and adjusts the
+// context for the content of elements that are not special in foreign
+// content.
+//
+// In foreign content (SVG or MathML), the content of title and textarea
+// elements is parsed as markup, not RCDATA, and a tag like <script/> or
+// <style/> is self-closing, so the escaping context after the tag must be
+// HTML text. The content of script and style elements is still escaped as JS
+// and CSS, since SVG script and style elements are run.
+//
+// Whether an annotation-xml element contains HTML or MathML depends on its
+// encoding attribute, which is only recognized if it is written as a literal.
+func (e *Escaper) trackForeign() {
+	t := &e.tag
+	if t.end {
+		if (t.name == "p" || t.name == "br") && e.inForeignContent() {
+			// These end tags break out of foreign content too.
+			t.foreign = strings.TrimRight(t.foreign, foreignContent)
+			return
+		}
+		if n := len(t.foreign); n > 0 {
+			if strings.IndexByte(foreignElements[t.name], t.foreign[n-1]) != -1 {
+				t.foreign = t.foreign[:n-1]
+			}
+		}
+		return
+	}
+
+	if !e.inForeignContent() {
+		if (t.name == "svg" || t.name == "math") && !t.slash {
+			t.foreign += foreignElements[t.name]
+		}
+		return
+	}
+	if breakoutElements[t.name] {
+		// Go back to the nearest HTML integration point, or out of
+		// foreign content altogether.
+		t.foreign = strings.TrimRight(t.foreign, foreignContent)
+		return
+	}
+	if el := e.ctx.element; el != elementNone && (t.slash || el == elementTitle || el == elementTextarea) {
+		e.ctx = context{}
+	}
+	if t.slash {
+		return
+	}
+	top := t.foreign[len(t.foreign)-1]
+	switch {
+	case t.name == "svg" && top != 'm':
+		// In MathML, only annotation-xml can contain SVG.
+		t.foreign += "s"
+	case top == 's':
+		switch t.name {
+		case "desc", "foreignobject", "title":
+			t.foreign += foreignElements[t.name]
+		}
+	case t.name == "annotation-xml":
+		if t.htmlEncoding {
+			t.foreign += "A"
+		} else {
+			t.foreign += "x"
+		}
+	default:
+		switch t.name {
+		case "mi", "mn", "mo", "ms", "mtext":
+			t.foreign += foreignElements[t.name]
+		}
+	}
+}
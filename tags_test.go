@@ -0,0 +1,293 @@
+package escaper
+
+import (
+	"html/template"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestNormalizeVoidElements(t *testing.T) {
+	tests := []struct {
+		name  string
+		xhtml bool
+		in    []interface{}
+		want  string
+	}{
+		{"HTML", false, []interface{}{"<p>a<br/>b<br />c<br></p>"}, "<p>a<br>b<br>c<br></p>"},
+		{"XHTML", true, []interface{}{"<p>a<br>b<br/>c</p>"}, "<p>a<br/>b<br/>c</p>"},
+		{"XHTML attributes", true, []interface{}{`<img src="a.png" alt="">`}, `<img src="a.png" alt=""/>`},
+		{"XHTML unquoted", true, []interface{}{"<img src=a.png>"}, "<img src=a.png />"},
+		{"XHTML with value", true, []interface{}{`<img alt="`, "x", `">`}, `<img alt="x"/>`},
+		{"HTML with value", false, []interface{}{`<img alt="`, "x", `"/>`}, `<img alt="x">`},
+		{"not void", false, []interface{}{"<div/><p/>"}, "<div/><p/>"},
+		{"XHTML not void", true, []interface{}{"<div></div>"}, "<div></div>"},
+		{"end tag", true, []interface{}{"<br></br>"}, "<br/></br>"},
+		{"slash in attribute", false, []interface{}{`<a href="/x/"><img src=/a/b.png></a>`}, `<a href="/x/"><img src=/a/b.png></a>`},
+	}
+	for _, tt := range tests {
+		got, err := render(func(e *Escaper) {
+			e.NormalizeVoidElements = true
+			e.XHTML = tt.xhtml
+		}, tt.in...)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+
+	// The tag is split between literals.
+	var b strings.Builder
+	e := New(&b)
+	e.NormalizeVoidElements = true
+	e.XHTML = true
+	e.Literal("<br")
+	e.Literal(">")
+	if got, want := b.String(), "<br/>"; got != want {
+		t.Errorf("split: got %q, want %q", got, want)
+	}
+	// A slash that was written by an earlier call can't be removed.
+	b.Reset()
+	e.XHTML = false
+	e.Literal("<br/")
+	e.Literal(">")
+	if got, want := b.String(), "<br/>"; got != want {
+		t.Errorf("split slash: got %q, want %q", got, want)
+	}
+
+	// Off by default.
+	got, _ := render(nil, "<br/><br>")
+	if want := "<br/><br>"; got != want {
+		t.Errorf("default: got %q, want %q", got, want)
+	}
+}
+
+func TestMaxAttributes(t *testing.T) {
+	tests := []struct {
+		name  string
+		max   int
+		args  []interface{}
+		want  string
+		warns int
+	}{
+		{"under limit", 3, []interface{}{`<a href="/" title="x">`}, `<a href="/" title="x">`, 0},
+		{"over limit", 2, []interface{}{`<a href="/" title="x" id="y" class="z">`}, `<a href="/" title="x" id="y" class="z">`, 1},
+		{"limit per tag", 2, []interface{}{`<a href="/" title="x"><b id="y" class="z">`}, `<a href="/" title="x"><b id="y" class="z">`, 0},
+		{"injected attribute", 0, []interface{}{"<a ", template.HTMLAttr(`title="x" onclick="alert(1)"`), ">"}, `<a title="x" onclick="alert(1)">`, 0},
+		{"injected attribute with lint", 5, []interface{}{"<a ", template.HTMLAttr(`title="x" onclick="alert(1)"`), ">"}, `<a title="x" onclick="alert(1)">`, 1},
+		{"single attribute value", 5, []interface{}{"<a ", template.HTMLAttr(`title="x"`), ">"}, `<a title="x">`, 0},
+		{"untrusted", 5, []interface{}{"<a ", `onclick=alert(1)`, ">"}, `<a ZgotmplZ>`, 0},
+	}
+	for _, tt := range tests {
+		var warnings []error
+		got, err := render(func(e *Escaper) {
+			e.MaxAttributes = tt.max
+			e.Warn = func(err error) { warnings = append(warnings, err) }
+		}, tt.args...)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+		if len(warnings) != tt.warns {
+			t.Errorf("%s: got warnings %v, want %d", tt.name, warnings, tt.warns)
+		}
+		for _, w := range warnings {
+			if ee, ok := w.(*Error); !ok || ee.ErrorCode != ErrAttrCount {
+				t.Errorf("%s: got warning %v, want ErrAttrCount", tt.name, w)
+			}
+		}
+	}
+}
+
+func TestLeadingNewline(t *testing.T) {
+	runValueTests(t, nil, []valueTest{
+		{"textarea", "<textarea>", "</textarea>", "\nx", "<textarea>\n\nx</textarea>"},
+		{"textarea no newline", "<textarea>", "</textarea>", "x\n", "<textarea>x\n</textarea>"},
+		{"textarea attributes", `<textarea name="t">`, "</textarea>", "\n", "<textarea name=\"t\">\n\n</textarea>"},
+		{"pre", "<pre>", "</pre>", "\n  code", "<pre>\n\n  code</pre>"},
+		{"listing", "<listing>", "</listing>", "\nx", "<listing>\n\nx</listing>"},
+		{"not first", "<textarea>a", "</textarea>", "\nx", "<textarea>a\nx</textarea>"},
+		{"after newline", "<pre>\n", "</pre>", "\nx", "<pre>\n\nx</pre>"},
+		{"div", "<div>", "</div>", "\nx", "<div>\nx</div>"},
+		{"end tag", "<pre></pre>", "", "\nx", "<pre></pre>\nx"},
+	})
+}
+
+func TestCheckTagBalance(t *testing.T) {
+	tests := []struct {
+		name     string
+		html     string
+		unclosed string
+	}{
+		{"balanced", "<html><body><div><p>x</p></div></body></html>", ""},
+		{"unclosed div", "<div><p>x</p>", "div"},
+		{"unclosed nested", "<main><section><div>", "main, section, div"},
+		{"implicitly closed", "<div><span>Hello</div>", "span"},
+		{"optional end tags", "<ul><li>a<li>b</ul><p>c", ""},
+		{"void", "<div><br><img src=x><input></div>", ""},
+		{"self-closing svg", `<svg><circle r="1"/></svg>`, ""},
+		{"stray end tag", "</div>", ""},
+	}
+	for _, tt := range tests {
+		var b strings.Builder
+		e := New(&b)
+		e.CheckTagBalance = true
+		if err := e.Literal(tt.html); err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		err := e.Finish()
+		if tt.unclosed == "" {
+			if err != nil {
+				t.Errorf("%s: %v", tt.name, err)
+			}
+			continue
+		}
+		ee, ok := err.(*Error)
+		if !ok || ee.ErrorCode != ErrUnclosed {
+			t.Errorf("%s: got error %v, want ErrUnclosed", tt.name, err)
+			continue
+		}
+		if want := "unclosed elements: " + tt.unclosed; ee.Description != want {
+			t.Errorf("%s: got %q, want %q", tt.name, ee.Description, want)
+		}
+	}
+
+	// Off by default.
+	e := New(io.Discard)
+	e.Literal("<div>")
+	if err := e.Finish(); err != nil {
+		t.Errorf("without CheckTagBalance: %v", err)
+	}
+}
+
+func TestSVG(t *testing.T) {
+	const js = "javascript:alert(1)"
+	runValueTests(t, nil, []valueTest{
+		{"title is markup", `<svg><title><a href="`, `">`, js, `<svg><title><a href="#ZgotmplZ">`},
+		{"self-closing style", `<svg><style/><a href="`, `">`, js, `<svg><style/><a href="#ZgotmplZ">`},
+		{"script", "<svg><script>var x = ", ";</script>", "a", `<svg><script>var x = "a";</script>`},
+		{"style", "<svg><style>p { color: ", " }</style>", "red;x", "<svg><style>p { color: ZgotmplZ }</style>"},
+		{"desc integration point", `<svg><desc><title><a href="`, `">`, js, `<svg><desc><title><a href="` + js + `">`},
+		{"foreignObject integration point", `<svg><foreignObject><title><a href="`, `">`, js, `<svg><foreignObject><title><a href="` + js + `">`},
+		{"breakout", `<svg><p><title><a href="`, `">`, js, `<svg><p><title><a href="` + js + `">`},
+		{"after svg", `<svg></svg><title><a href="`, `">`, js, `<svg></svg><title><a href="` + js + `">`},
+		{"self-closing svg", `<svg/><title><a href="`, `">`, js, `<svg/><title><a href="` + js + `">`},
+		{"nested svg", `<svg><svg></svg><title><a href="`, `">`, js, `<svg><svg></svg><title><a href="#ZgotmplZ">`},
+		{"end br breakout", `<svg></br><title><a href="`, `">`, js, `<svg></br><title><a href="` + js + `">`},
+		{"end p breakout", `<svg></p><title><a href="`, `">`, js, `<svg></p><title><a href="` + js + `">`},
+	})
+}
+
+func TestMathML(t *testing.T) {
+	const js = "javascript:alert(1)"
+	runValueTests(t, nil, []valueTest{
+		{"title is markup", `<math><title><a href="`, `">`, js, `<math><title><a href="#ZgotmplZ">`},
+		{"text integration point", `<math><mi><title><a href="`, `">`, js, `<math><mi><title><a href="` + js + `">`},
+		{"after math", `<math></math><title><a href="`, `">`, js, `<math></math><title><a href="` + js + `">`},
+		{"annotation-xml", `<math><annotation-xml><title><a href="`, `">`, js, `<math><annotation-xml><title><a href="#ZgotmplZ">`},
+		{"annotation-xml HTML", `<math><annotation-xml encoding="text/html"><title><a href="`, `">`, js, `<math><annotation-xml encoding="text/html"><title><a href="` + js + `">`},
+		{"annotation-xml XHTML", `<math><annotation-xml encoding='Application/XHTML+XML'><title><a href="`, `">`, js, `<math><annotation-xml encoding='Application/XHTML+XML'><title><a href="` + js + `">`},
+		{"annotation-xml other", `<math><annotation-xml encoding="image/svg+xml"><title><a href="`, `">`, js, `<math><annotation-xml encoding="image/svg+xml"><title><a href="#ZgotmplZ">`},
+		{"svg in annotation-xml", `<math><annotation-xml><svg><desc><title><a href="`, `">`, js, `<math><annotation-xml><svg><desc><title><a href="` + js + `">`},
+	})
+}
+
+func TestCDATA(t *testing.T) {
+	const js = "javascript:alert(1)"
+	runValueTests(t, nil, []valueTest{
+		{"value", "<svg><text><![CDATA[", "]]></text>", "a<b>&amp;", "<svg><text><![CDATA[a<b]]>&gt;<![CDATA[&amp;]]></text>"},
+		{"section end", "<svg><text><![CDATA[", "]]></text>", "]]>", "<svg><text><![CDATA[]]>&#93;<![CDATA[]]>&#93;<![CDATA[]]>&gt;<![CDATA[]]></text>"},
+		{"split section end", "<svg><text><![CDATA[]", "]></text>", "]", "<svg><text><![CDATA[]]]>&#93;<![CDATA[]></text>"},
+		{"tags in section", `<svg><![CDATA[</svg><p>]]><title><a href="`, `">`, js, `<svg><![CDATA[</svg><p>]]><title><a href="#ZgotmplZ">`},
+		{"after section", "<svg><![CDATA[x]]>", "</svg>", "<b>", "<svg><![CDATA[x]]>&lt;b&gt;</svg>"},
+		{"math", "<math><![CDATA[", "]]>", "x", "<math><![CDATA[x]]>"},
+		{"integration point", "<math><mtext><![CDATA[", "]]>", "x", "<math><mtext><![CDATA[]]>"},
+		{"HTML", "<p><![CDATA[x]]>", "", "<b>", "<p><![CDATA[x]]>&lt;b&gt;"},
+		{"HTML value", "<p><![CDATA[", "]]>", "<b>", "<p><![CDATA[]]>"},
+		{"after end p", "<svg></p><![CDATA[", "]]>", "<b>", "<svg></p><![CDATA[]]>"},
+		{"HTML ends at >", `<![CDATA[>]]><title><a href="`, `">`, js, `<![CDATA[>]]><title><a href="` + js + `">`},
+	})
+
+	e := New(io.Discard)
+	e.Literal("<svg><![CDATA[")
+	if c := e.Context(); c.c.state != stateCDATA {
+		t.Errorf("in svg: got %v, want stateCDATA", c)
+	}
+	e.Reset(io.Discard)
+	e.Literal("<![CDATA[")
+	if c := e.Context(); !c.InComment() {
+		t.Errorf("in HTML: got %v, want a comment", c)
+	}
+}
+
+func TestTemplateElement(t *testing.T) {
+	runValueTests(t, nil, []valueTest{
+		{"text", "<template><p>", "</p></template>", "<x>", "<template><p>&lt;x&gt;</p></template>"},
+		{"script", "<template><script>var x = ", ";</script></template>", "a", `<template><script>var x = "a";</script></template>`},
+		{"style", "<template><style>p { color: ", " }</style></template>", "red", "<template><style>p { color: red }</style></template>"},
+		{"URL", `<template><a href="`, `"></a></template>`, "javascript:x", `<template><a href="#ZgotmplZ"></a></template>`},
+	})
+
+	tests := []struct {
+		html string
+		want bool
+	}{
+		{"<template>", true},
+		{"<template><template></template>", true},
+		{"<template><template></template></template>", false},
+		{"</template><p>", false},
+		{"<template><script>var x = '</template>'", true},
+		{"<svg><template>", false},
+		{"<template><svg></svg>", true},
+	}
+	for _, tt := range tests {
+		e := New(io.Discard)
+		if err := e.Literal(tt.html); err != nil {
+			t.Errorf("%q: %v", tt.html, err)
+			continue
+		}
+		if got := e.Context().InTemplate(); got != tt.want {
+			t.Errorf("%q: InTemplate() = %v, want %v", tt.html, got, tt.want)
+		}
+	}
+}
+
+func TestAutoNonce(t *testing.T) {
+	tests := []struct {
+		name  string
+		nonce string
+		in    []interface{}
+		want  string
+	}{
+		{"script", "abc", []interface{}{"<script>x()</script>"}, `<script nonce="abc">x()</script>`},
+		{"style", "abc", []interface{}{"<style>p {}</style>"}, `<style nonce="abc">p {}</style>`},
+		{"attributes", "abc", []interface{}{`<script src="a.js"></script>`}, `<script nonce="abc" src="a.js"></script>`},
+		{"uppercase", "abc", []interface{}{"<SCRIPT>x()</SCRIPT>"}, `<SCRIPT nonce="abc">x()</SCRIPT>`},
+		{"end tag", "abc", []interface{}{"</script>"}, "</script>"},
+		{"other tags", "abc", []interface{}{"<p>a</p><scripts>"}, "<p>a</p><scripts>"},
+		{"in text", "abc", []interface{}{"<p>", "<script>", "</p>"}, "<p>&lt;script&gt;</p>"},
+		{"in attribute", "abc", []interface{}{`<a title="<script>">`}, `<a title="<script>">`},
+		{"escaped", `a"b`, []interface{}{"<script></script>"}, `<script nonce="a&#34;b"></script>`},
+		{"no nonce", "", []interface{}{"<script></script>"}, "<script></script>"},
+	}
+	for _, tt := range tests {
+		got, err := render(func(e *Escaper) {
+			e.AutoNonce = true
+			e.Nonce = tt.nonce
+		}, tt.in...)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
@@ -12,14 +12,19 @@ import "strings"
 // input.
 var transitionFunc = [...]func(context, string) (context, int){
 	stateText:        tText,
+	stateTagOpen:     tTagOpen,
+	stateEndTagOpen:  tTagOpen,
 	stateTag:         tTag,
 	stateAttrName:    tAttrName,
 	stateAfterName:   tAfterName,
 	stateBeforeValue: tBeforeValue,
 	stateHTMLCmt:     tHTMLCmt,
+	stateBogusCmt:    tBogusCmt,
+	stateCDATA:       tCDATA,
 	stateRCDATA:      tSpecialTagEnd,
 	stateAttr:        tAttr,
 	stateURL:         tURL,
+	stateSrcset:      tURL,
 	stateJS:          tJS,
 	stateJSDqStr:     tJSDelimited,
 	stateJSSqStr:     tJSDelimited,
@@ -39,24 +44,41 @@ var transitionFunc = [...]func(context, string) (context, int){
 
 var commentStart = "<!--"
 var commentEnd = "-->"
+var cdataStart = "<![CDATA["
+var cdataEnd = "]]>"
 
 // tText is the context transition function for the text state.
 func tText(c context, s string) (context, int) {
 	k := 0
 	for {
 		i := k + strings.IndexByte(s[k:], '<')
-		if i < k || i+1 == len(s) {
+		if i < k {
 			return c, len(s)
+		} else if i+1 == len(s) {
+			// The tag name (if any) will come in the next chunk of text.
+			return context{state: stateTagOpen}, len(s)
 		} else if i+4 <= len(s) && s[i:i+4] == commentStart {
 			return context{state: stateHTMLCmt}, i + 4
+		} else if strings.HasPrefix(s[i:], cdataStart) {
+			// This is only a CDATA section in foreign content;
+			// trackTag turns it into a bogus comment elsewhere.
+			return context{state: stateCDATA}, i + len(cdataStart)
+		} else if s[i+1] == '!' || s[i+1] == '?' {
+			// A DOCTYPE or a bogus comment.
+			return context{state: stateBogusCmt}, i + 2
 		}
 		i++
 		end := false
 		if s[i] == '/' {
 			if i+1 == len(s) {
-				return c, len(s)
+				return context{state: stateEndTagOpen}, len(s)
 			}
 			end, i = true, i+1
+			if s[i] != '>' && !asciiAlpha(s[i]) {
+				// "</" followed by something other than a tag name
+				// starts a bogus comment.
+				return context{state: stateBogusCmt}, i
+			}
 		}
 		j, e := eatTagName(s, i)
 		if j != i {
@@ -70,18 +92,33 @@ func tText(c context, s string) (context, int) {
 	}
 }
 
+// tTagOpen is the context transition function for stateTagOpen and
+// stateEndTagOpen. It processes s as if the "<" or "</" that preceded it
+// were part of the same text.
+func tTagOpen(c context, s string) (context, int) {
+	prefix := "<"
+	if c.state == stateEndTagOpen {
+		prefix = "</"
+	}
+	c, i := tText(context{}, prefix+s)
+	return c, i - len(prefix)
+}
+
 var elementContentType = [...]state{
 	elementNone:     stateText,
 	elementScript:   stateJS,
 	elementStyle:    stateCSS,
 	elementTextarea: stateRCDATA,
 	elementTitle:    stateRCDATA,
+
+	elementJSONScript: stateJS,
 }
 
 // tTag is the context transition function for the tag state.
 func tTag(c context, s string) (context, int) {
-	// Find the attribute name.
-	i := eatWhiteSpace(s, 0)
+	// Find the attribute name. A slash between attributes is treated like
+	// white space, as in "<a/href=...>", which has an href attribute.
+	i := eatWhiteSpaceAndSlashes(s, 0)
 	if i == len(s) {
 		return c, len(s)
 	}
@@ -105,10 +142,18 @@ func tTag(c context, s string) (context, int) {
 	switch attrType(string(s[i:j])) {
 	case contentTypeURL:
 		attr = attrURL
+	case contentTypeSrcset:
+		attr = attrSrcset
 	case contentTypeCSS:
 		attr = attrStyle
 	case contentTypeJS:
 		attr = attrScript
+	default:
+		if c.element == elementScript && strings.EqualFold(s[i:j], "type") {
+			attr = attrScriptType
+		} else if isLangAttr(s[i:j]) {
+			attr = attrLang
+		}
 	}
 	if j == len(s) {
 		state = stateAttrName
@@ -150,6 +195,10 @@ var attrStartStates = [...]state{
 	attrScript: stateJS,
 	attrStyle:  stateCSS,
 	attrURL:    stateURL,
+	attrSrcset: stateSrcset,
+	attrLang:   stateAttr,
+
+	attrScriptType: stateAttr,
 }
 
 // tBeforeValue is the context transition function for stateBeforeValue.
@@ -178,6 +227,22 @@ func tHTMLCmt(c context, s string) (context, int) {
 	return c, len(s)
 }
 
+// tBogusCmt is the context transition function for stateBogusCmt.
+func tBogusCmt(c context, s string) (context, int) {
+	if i := strings.IndexByte(s, '>'); i != -1 {
+		return context{}, i + 1
+	}
+	return c, len(s)
+}
+
+// tCDATA is the context transition function for stateCDATA.
+func tCDATA(c context, s string) (context, int) {
+	if i := strings.Index(s, cdataEnd); i != -1 {
+		return context{}, i + len(cdataEnd)
+	}
+	return c, len(s)
+}
+
 // specialTagEndMarkers maps element types to the character sequence that
 // case-insensitively signals the end of the special tag body.
 var specialTagEndMarkers = [...]string{
@@ -185,6 +250,8 @@ var specialTagEndMarkers = [...]string{
 	elementStyle:    "style",
 	elementTextarea: "textarea",
 	elementTitle:    "title",
+
+	elementJSONScript: "script",
 }
 
 var (
@@ -510,7 +577,7 @@ func tError(c context, s string) (context, int) {
 func eatAttrName(s string, i int) (int, *Error) {
 	for j := i; j < len(s); j++ {
 		switch s[j] {
-		case ' ', '\t', '\n', '\f', '\r', '=', '>':
+		case ' ', '\t', '\n', '\f', '\r', '=', '>', '/':
 			return j, nil
 		case '\'', '"', '<':
 			// These result in a parse warning in HTML5 and are
@@ -575,3 +642,17 @@ func eatWhiteSpace(s string, i int) int {
 	}
 	return len(s)
 }
+
+// eatWhiteSpaceAndSlashes returns the largest j such that s[i:j] is white
+// space and slashes.
+func eatWhiteSpaceAndSlashes(s string, i int) int {
+	for j := i; j < len(s); j++ {
+		switch s[j] {
+		case ' ', '\t', '\n', '\f', '\r', '/':
+			// No-op.
+		default:
+			return j
+		}
+	}
+	return len(s)
+}
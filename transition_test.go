@@ -0,0 +1,124 @@
+package escaper
+
+import (
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestSelfClosingSlash(t *testing.T) {
+	tests := []struct {
+		before, after string
+		value         string
+		want          string
+	}{
+		{"<br ", " />", "class", "<br class />"},
+		{"<br ", "/>", "class", "<br class/>"},
+		{"<br ", " />", "onclick", "<br ZgotmplZ />"},
+		{"<br ", " />", "a b", "<br ZgotmplZ />"},
+		{"<input ", "/>", "disabled", "<input disabled/>"},
+		{`<input type="checkbox" `, " />", "checked", `<input type="checkbox" checked />`},
+	}
+	for _, tt := range tests {
+		var b strings.Builder
+		e := New(&b)
+		e.Literal(tt.before)
+		if err := e.Value(tt.value); err != nil {
+			t.Errorf("%s%s%s: %v", tt.before, tt.value, tt.after, err)
+			continue
+		}
+		if err := e.Literal(tt.after); err != nil {
+			t.Errorf("%s%s%s: %v", tt.before, tt.value, tt.after, err)
+			continue
+		}
+		if !e.Context().InText() {
+			t.Errorf("%s%s%s: context %v after tag, want text", tt.before, tt.value, tt.after, e.Context())
+		}
+		if err := e.Value("<x>"); err != nil {
+			t.Errorf("%s%s%s: %v", tt.before, tt.value, tt.after, err)
+		}
+		if got, want := b.String(), tt.want+"&lt;x&gt;"; got != want {
+			t.Errorf("got %q, want %q", got, want)
+		}
+	}
+}
+
+func TestSlashBetweenAttributes(t *testing.T) {
+	// A slash between attributes is treated like white space.
+	tests := []struct {
+		slash, space string
+	}{
+		{`<a/href="`, `<a href="`},
+		{`<a title="x"/href="`, `<a title="x" href="`},
+		{`<a / onclick="`, `<a   onclick="`},
+		{`<a href/title`, `<a href title`},
+		{`<a href/>`, `<a href >`},
+		{`<a //>`, `<a   >`},
+	}
+	for _, tt := range tests {
+		e := New(io.Discard)
+		if err := e.Literal(tt.slash); err != nil {
+			t.Errorf("%s: %v", tt.slash, err)
+			continue
+		}
+		w := New(io.Discard)
+		w.Literal(tt.space)
+		if got, want := e.Context(), w.Context(); !got.c.eq(want.c) {
+			t.Errorf("%s: context %v, want %v", tt.slash, got, want)
+		}
+	}
+}
+
+func TestEntityInAttr(t *testing.T) {
+	runValueTests(t, nil, []valueTest{
+		{"&quot;", `<a title="He said &quot;`, `&quot;">`, `"hi"`, `<a title="He said &quot;&#34;hi&#34;&quot;">`},
+		{"&#34;", `<a title="He said &#34;`, `">`, `x" onclick="y`, `<a title="He said &#34;x&#34; onclick=&#34;y">`},
+		{"&#x22;", `<a title="He said &#x22;`, `">`, `x"`, `<a title="He said &#x22;x&#34;">`},
+		{"&apos;", `<a title='it&apos;s `, `'>`, `'`, `<a title='it&apos;s &#39;'>`},
+		{"&quot; in URL", `<a href="/x?q=&quot;`, `">`, `"`, `<a href="/x?q=&quot;%22">`},
+		{"&quot; in handler", `<a onclick="f(&quot;`, `&quot;)">`, `"); alert(1); ("`, `<a onclick="f(&quot;\x22); alert(1); (\x22&quot;)">`},
+	})
+
+	// The entity doesn't end the attribute value.
+	e := New(io.Discard)
+	e.Literal(`<a title="He said &quot;`)
+	if got := e.Context(); !got.InAttr() {
+		t.Errorf("context %v after &quot;, want attribute value", got)
+	}
+}
+
+func TestBogusComment(t *testing.T) {
+	tests := []struct {
+		html    string
+		comment bool
+		want    string
+	}{
+		{"<!DOCTYPE html>", false, "<!DOCTYPE html>&lt;i&gt;"},
+		{"<!doctype html", true, "<!doctype html"},
+		{"<!x>", false, "<!x>&lt;i&gt;"},
+		{"<!>", false, "<!>&lt;i&gt;"},
+		{`<?xml version="1.0"?>`, false, `<?xml version="1.0"?>&lt;i&gt;`},
+		{"<?", true, "<?"},
+		{"</ x>", false, "</ x>&lt;i&gt;"},
+		{"</3>", false, "</3>&lt;i&gt;"},
+		{"<!x <b>", false, "<!x <b>&lt;i&gt;"},
+		{"<!-- x >", true, "<!-- x >"},
+	}
+	for _, tt := range tests {
+		var b strings.Builder
+		e := New(&b)
+		if err := e.Literal(tt.html); err != nil {
+			t.Errorf("%s: %v", tt.html, err)
+			continue
+		}
+		if got := e.Context(); got.InComment() != tt.comment || got.InText() == tt.comment {
+			t.Errorf("%s: context %v, want comment=%v", tt.html, got, tt.comment)
+		}
+		if err := e.Value("<i>"); err != nil {
+			t.Errorf("%s: %v", tt.html, err)
+		}
+		if got := b.String(); got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.html, got, tt.want)
+		}
+	}
+}
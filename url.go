@@ -12,17 +12,99 @@ import (
 
 // urlFilter returns its input unless it contains an unsafe protocol in which
 // case it defangs the entire URL.
+//
+// It applies to every URL-valued attribute, including the href of <base>,
+// where an unsafe URL would affect every relative URL in the page. Since
+// the Escaper doesn't resolve URLs, it doesn't need to keep track of the
+// base URL.
 func urlFilter(args ...interface{}) string {
 	s, t := stringify(args...)
 	if t == contentTypeURL {
 		return s
 	}
+	if !isSafeURL(s) {
+		return "#" + filterFailsafe
+	}
+	return s
+}
+
+// A URLContext describes where a URL that is passed to Escaper.URLPolicy is
+// being written.
+type URLContext struct {
+	// Element is the lowercase name of the element, and Attr is the
+	// lowercase name of the attribute, if the URL is in an attribute.
+	Element string
+	Attr    string
+
+	// CSS is true for a URL in a CSS url(...) or string, and Srcset is
+	// true for an image candidate URL in a srcset attribute.
+	CSS    bool
+	Srcset bool
+
+	// Trusted is true if the URL is of type template.URL.
+	Trusted bool
+}
+
+// DefaultURLPolicy is the policy that is used for URLs if Escaper.URLPolicy
+// is nil. It allows trusted URLs, relative URLs, and URLs with the http,
+// https, and mailto schemes. A URL policy can call it to add restrictions of
+// its own on top of it.
+func DefaultURLPolicy(url string, ctx URLContext) (string, bool) {
+	return url, ctx.Trusted || isSafeURL(url)
+}
+
+// isSafeURL is true if s is a relative URL or if URL has a protocol in
+// (http, https, mailto).
+func isSafeURL(s string) bool {
+	switch urlScheme(s) {
+	case "", "http", "https", "mailto":
+		return true
+	}
+	return false
+}
+
+// urlScheme returns the lowercase scheme of s, or "" if s is a relative URL.
+func urlScheme(s string) string {
 	if i := strings.IndexRune(s, ':'); i >= 0 && !strings.ContainsRune(s[:i], '/') {
-		protocol := strings.ToLower(s[:i])
-		if protocol != "http" && protocol != "https" && protocol != "mailto" {
-			return "#" + filterFailsafe
+		return strings.ToLower(s[:i])
+	}
+	return ""
+}
+
+// isAllowedDataURL reports whether the data: URL s has one of the media types
+// in types. A type may be "*", or end with "/*" to match any subtype except
+// svg+xml; an SVG document can run scripts when it is loaded by an iframe,
+// object, or embed element, so it must be allowed by name.
+func isAllowedDataURL(s string, types []string) bool {
+	mediaType := s[len("data:"):]
+	if i := strings.IndexAny(mediaType, ";,"); i >= 0 {
+		mediaType = mediaType[:i]
+	}
+	mediaType = strings.ToLower(strings.TrimSpace(mediaType))
+	if mediaType == "" {
+		// RFC 2397 section 2
+		mediaType = "text/plain"
+	}
+	for _, t := range types {
+		t = strings.ToLower(t)
+		switch {
+		case t == "*", t == mediaType:
+			return true
+		case strings.HasSuffix(t, "/*") && strings.HasPrefix(mediaType, t[:len(t)-1]) && !strings.HasSuffix(mediaType, "/svg+xml"):
+			return true
 		}
 	}
+	return false
+}
+
+// fragmentFilter returns its input if it is a URL that consists only of a
+// fragment (#id), and "#ZgotmplZ" otherwise. Unlike urlFilter, it does not
+// trust values of type template.URL.
+func fragmentFilter(args ...interface{}) string {
+	s, _ := stringify(args...)
+	if !strings.HasPrefix(s, "#") {
+		return "#" + filterFailsafe
+	}
 	return s
 }
 
@@ -41,6 +123,36 @@ func urlNormalizer(args ...interface{}) string {
 	return urlProcessor(true, args...)
 }
 
+// urlStrictNormalizer is like urlNormalizer, but it also percent-encodes the
+// sub-delimiters from RFC 3986, except for those that separate query
+// parameters in the query and fragment. Values of type template.URL are
+// normalized as usual.
+func urlStrictNormalizer(args ...interface{}) string {
+	s, t := stringify(args...)
+	if t == contentTypeURL {
+		return urlNormalizer(args...)
+	}
+	path, query := s, ""
+	if i := strings.IndexAny(s, "?#"); i != -1 {
+		path, query = s[:i], s[i:]
+	}
+	var b bytes.Buffer
+	percentEncodeBytes(&b, path, "!$&'()*+,;=")
+	percentEncodeBytes(&b, query, "!$'()*+,")
+	return urlNormalizer(b.String())
+}
+
+// percentEncodeBytes writes s to b, percent-encoding the bytes in set.
+func percentEncodeBytes(b *bytes.Buffer, s string, set string) {
+	for i := 0; i < len(s); i++ {
+		if c := s[i]; strings.IndexByte(set, c) != -1 {
+			fmt.Fprintf(b, "%%%02X", c)
+		} else {
+			b.WriteByte(c)
+		}
+	}
+}
+
 // urlProcessor normalizes (when norm is true) or escapes its input to produce
 // a valid hierarchical or opaque URL part.
 func urlProcessor(norm bool, args ...interface{}) string {
@@ -49,6 +161,16 @@ func urlProcessor(norm bool, args ...interface{}) string {
 		norm = true
 	}
 	var b bytes.Buffer
+	if processURLOnto(s, norm, &b) {
+		return b.String()
+	}
+	return s
+}
+
+// processURLOnto appends a normalized URL corresponding to its input to b
+// and reports whether the appended content differs from s.
+func processURLOnto(s string, norm bool, b *bytes.Buffer) bool {
+	b.Grow(len(s) + 16)
 	written := 0
 	// The byte loop below assumes that all URLs use UTF-8 as the
 	// content-encoding. This is similar to the URI to IRI encoding scheme
@@ -56,6 +178,9 @@ func urlProcessor(norm bool, args ...interface{}) string {
 	// EcmaScript builtin encodeURIComponent.
 	// It should not cause any misencoding of URLs in pages with
 	// Content-type: text/html;charset=UTF-8.
+	// Invalid UTF-8 is not replaced with U+FFFD; each byte that is not
+	// part of a valid sequence is percent-encoded as it is, like any other
+	// non-ASCII byte, so the bytes round-trip and the output is plain ASCII.
 	for i, n := 0, len(s); i < n; i++ {
 		c := s[i]
 		switch c {
@@ -94,12 +219,126 @@ func urlProcessor(norm bool, args ...interface{}) string {
 			}
 		}
 		b.WriteString(s[written:i])
-		fmt.Fprintf(&b, "%%%02x", c)
+		// Each byte of a multi-byte UTF-8 sequence is escaped separately,
+		// with uppercase hex digits as recommended by RFC 3986 sec 2.1.
+		fmt.Fprintf(b, "%%%02X", c)
 		written = i + 1
 	}
-	if written == 0 {
+	b.WriteString(s[written:])
+	return written != 0
+}
+
+// srcsetFilterAndEscaper filters and normalizes srcset values, which are
+// comma-separated URLs followed by metadata.
+func srcsetFilterAndEscaper(args ...interface{}) string {
+	return filterSrcset(nil, args...)
+}
+
+// filterSrcset is like srcsetFilterAndEscaper, but it checks URLs with check
+// instead of isSafeURL if check is not nil. Check returns the URL to use,
+// and whether it is allowed.
+func filterSrcset(check func(url string, trusted bool) (string, bool), args ...interface{}) string {
+	if check == nil {
+		check = func(url string, trusted bool) (string, bool) {
+			return url, trusted || isSafeURL(url)
+		}
+	}
+	s, t := stringify(args...)
+	switch t {
+	case contentTypeSrcset:
 		return s
+	case contentTypeURL:
+		var ok bool
+		if s, ok = check(s, true); !ok {
+			return "#" + filterFailsafe
+		}
+		// Normalizing gets rid of all HTML whitespace
+		// which separate the image URL from its metadata.
+		var b bytes.Buffer
+		if processURLOnto(s, true, &b) {
+			s = b.String()
+		}
+		// Additionally, commas separate one source from another.
+		return strings.Replace(s, ",", "%2C", -1)
 	}
-	b.WriteString(s[written:])
+
+	var b bytes.Buffer
+	written := 0
+	for i := 0; i < len(s); i++ {
+		if s[i] == ',' {
+			filterSrcsetElement(s, written, i, &b, check)
+			b.WriteString(",")
+			written = i + 1
+		}
+	}
+	filterSrcsetElement(s, written, len(s), &b, check)
 	return b.String()
 }
+
+// Derived from https://play.golang.org/p/Dhmj7FORT5
+const htmlSpaceAndASCIIAlnumBytes = "\x00\x36\x00\x00\x01\x00\xff\x03\xfe\xff\xff\x07\xfe\xff\xff\x07"
+
+// isHTMLSpace is true iff c is a whitespace character per
+// https://infra.spec.whatwg.org/#ascii-whitespace
+func isHTMLSpace(c byte) bool {
+	return (c <= 0x20) && 0 != (htmlSpaceAndASCIIAlnumBytes[c>>3]&(1<<uint(c&0x7)))
+}
+
+// filterSrcsetElement writes the image candidate s[left:right] to b, with its
+// URL normalized, or a failsafe value if check rejects the URL or the metadata
+// is invalid.
+func filterSrcsetElement(s string, left int, right int, b *bytes.Buffer, check func(string, bool) (string, bool)) {
+	start := left
+	for start < right && isHTMLSpace(s[start]) {
+		start++
+	}
+	end := right
+	for i := start; i < right; i++ {
+		if isHTMLSpace(s[i]) {
+			end = i
+			break
+		}
+	}
+	// Keep the white space that separates the candidate from the
+	// previous one, even if it is replaced.
+	b.WriteString(s[left:start])
+	if url, ok := check(s[start:end], false); ok {
+		if isSrcsetDescriptors(s[end:right]) {
+			processURLOnto(url, true, b)
+			b.WriteString(s[end:right])
+			return
+		}
+	}
+	b.WriteString("#")
+	b.WriteString(filterFailsafe)
+}
+
+// isSrcsetDescriptors reports whether s is a valid list of image candidate
+// descriptors: white space, followed by optional width or pixel density
+// descriptors such as "100w" or "1.5x", separated by white space. These don't
+// need to be URL normalized.
+func isSrcsetDescriptors(s string) bool {
+	for _, d := range strings.FieldsFunc(s, func(r rune) bool { return r < 0x80 && isHTMLSpace(byte(r)) }) {
+		if len(d) < 2 {
+			return false
+		}
+		num, unit := d[:len(d)-1], d[len(d)-1]
+		if unit != 'w' && unit != 'x' && unit != 'h' {
+			return false
+		}
+		dot := false
+		for i := 0; i < len(num); i++ {
+			switch c := num[i]; {
+			case c == '.' && !dot && unit != 'w' && unit != 'h':
+				dot = true
+			case '0' <= c && c <= '9':
+			default:
+				return false
+			}
+		}
+		if num == "." {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,205 @@
+package escaper
+
+import (
+	"html/template"
+	"strings"
+	"testing"
+)
+
+func TestURLUTF8(t *testing.T) {
+	tests := []struct {
+		in                  string
+		normalized, escaped string
+	}{
+		{"/café", "/caf%C3%A9", "%2Fcaf%C3%A9"},
+		{"/café?q=naïve", "/caf%C3%A9?q=na%C3%AFve", "%2Fcaf%C3%A9%3Fq%3Dna%C3%AFve"},
+		{"/日本", "/%E6%97%A5%E6%9C%AC", "%2F%E6%97%A5%E6%9C%AC"},
+		{"/😀", "/%F0%9F%98%80", "%2F%F0%9F%98%80"},
+		{"/caf%C3%A9", "/caf%C3%A9", "%2Fcaf%25C3%25A9"},
+	}
+	for _, tt := range tests {
+		if got := urlNormalizer(tt.in); got != tt.normalized {
+			t.Errorf("urlNormalizer(%q) = %q, want %q", tt.in, got, tt.normalized)
+		}
+		if got := urlEscaper(tt.in); got != tt.escaped {
+			t.Errorf("urlEscaper(%q) = %q, want %q", tt.in, got, tt.escaped)
+		}
+	}
+
+	runValueTests(t, nil, []valueTest{
+		{"href", `<a href="`, `">`, "/café?q=naïve", `<a href="/caf%C3%A9?q=na%C3%AFve">`},
+		{"query", `<a href="/search?q=`, `">`, "naïve café", `<a href="/search?q=na%C3%AFve%20caf%C3%A9">`},
+	})
+}
+
+func TestBaseHref(t *testing.T) {
+	runValueTests(t, nil, []valueTest{
+		{"javascript", `<base href="`, `">`, "javascript:alert(1)", `<base href="#ZgotmplZ">`},
+		{"auto-quoted", `<base href=`, `>`, "javascript:alert(1)", `<base href="#ZgotmplZ">`},
+		{"data", `<base href="`, `">`, "data:text/html,x", `<base href="#ZgotmplZ">`},
+		{"https", `<base href="`, `">`, "https://example.com/a/", `<base href="https://example.com/a/">`},
+		{"relative", `<base href="`, `">`, "/a b/", `<base href="/a%20b/">`},
+	})
+
+	// A URL policy can treat the base URL differently from other URLs.
+	runValueTests(t, func(e *Escaper) {
+		e.URLPolicy = func(url string, ctx URLContext) (string, bool) {
+			return url, ctx.Element != "base" && isSafeURL(url)
+		}
+	}, []valueTest{
+		{"policy", `<base href="`, `"><a href="`, "/x/", `<base href="#ZgotmplZ"><a href="`},
+	})
+}
+
+func TestURLInvalidUTF8(t *testing.T) {
+	tests := []struct {
+		in                  string
+		normalized, escaped string
+	}{
+		{"/a\xffb", "/a%FFb", "%2Fa%FFb"},
+		{"/\xc3", "/%C3", "%2F%C3"},
+		{"/\xc3\xa9\xff", "/%C3%A9%FF", "%2F%C3%A9%FF"},
+		{"/\xed\xa0\x80", "/%ED%A0%80", "%2F%ED%A0%80"},
+	}
+	for _, tt := range tests {
+		if got := urlNormalizer(tt.in); got != tt.normalized {
+			t.Errorf("urlNormalizer(%q) = %q, want %q", tt.in, got, tt.normalized)
+		}
+		if got := urlEscaper(tt.in); got != tt.escaped {
+			t.Errorf("urlEscaper(%q) = %q, want %q", tt.in, got, tt.escaped)
+		}
+	}
+
+	runValueTests(t, nil, []valueTest{
+		{"href", `<a href="`, `">`, "/a\xff?q=\xfe", `<a href="/a%FF?q=%FE">`},
+	})
+}
+
+func TestStrictURLEncoding(t *testing.T) {
+	trustedURL := template.URL("/a!b,c")
+	const subDelims = "!$&'()*+,;="
+	tests := []valueTest{
+		{"path", `<a href="`, `">`, "/a" + subDelims, `<a href="/a%21%24%26%27%28%29%2A%2B%2C%3B%3D">`},
+		{"query", `<a href="`, `">`, "/a?x=1&y=" + subDelims, `<a href="/a?x=1&amp;y=%21%24&amp;%27%28%29%2A%2B%2C;=">`},
+		{"unreserved", `<a href="`, `">`, "/A-z_0.9~", `<a href="/A-z_0.9~">`},
+		{"scheme", `<a href="`, `">`, "https://example.com/a(1)", `<a href="https://example.com/a%281%29">`},
+		{"query value", `<a href="/search?q=`, `">`, subDelims, `<a href="/search?q=%21%24%26%27%28%29%2A%2B%2C%3B%3D">`},
+		{"trusted", `<a href="`, `">`, template.URL("/a!b,c"), `<a href="/a!b,c">`},
+		{"trusted pointer", `<a href="`, `">`, &trustedURL, `<a href="/a!b,c">`},
+		{"trusted in CSS", `<p style="background: url(`, `)">`, template.URL("/a!b,c"), `<p style="background: url(/a!b,c)">`},
+	}
+	runValueTests(t, func(e *Escaper) { e.StrictURLEncoding = true }, tests)
+
+	runValueTests(t, nil, []valueTest{
+		{"lenient path", `<a href="`, `">`, "/a" + subDelims, `<a href="/a!$&amp;%27%28%29*&#43;,;=">`},
+	})
+}
+
+func TestURLPolicy(t *testing.T) {
+	var seen []URLContext
+	policy := func(e *Escaper) {
+		e.URLPolicy = func(url string, ctx URLContext) (string, bool) {
+			seen = append(seen, ctx)
+			switch {
+			case strings.HasPrefix(url, "http://example.com/"):
+				// Rewrite to https.
+				return "https" + url[len("http"):], true
+			case strings.HasPrefix(url, "/"):
+				return "", false
+			}
+			return DefaultURLPolicy(url, ctx)
+		}
+	}
+	tests := []struct {
+		valueTest
+		ctx URLContext
+	}{
+		{valueTest{"rewrite", `<a href="`, `">`, "http://example.com/a b", `<a href="https://example.com/a%20b">`}, URLContext{Element: "a", Attr: "href"}},
+		{valueTest{"reject relative", `<img src="`, `">`, "/a.png", `<img src="#ZgotmplZ">`}, URLContext{Element: "img", Attr: "src"}},
+		{valueTest{"default", `<a href="`, `">`, "javascript:x", `<a href="#ZgotmplZ">`}, URLContext{Element: "a", Attr: "href"}},
+		{valueTest{"trusted", `<a href="`, `">`, template.URL("javascript:x"), `<a href="javascript:x">`}, URLContext{Element: "a", Attr: "href", Trusted: true}},
+		{valueTest{"CSS attribute", `<p style="background: url(`, `)">`, "/a.png", `<p style="background: url(#ZgotmplZ)">`}, URLContext{Element: "p", Attr: "style", CSS: true}},
+		{valueTest{"style element", `<style>p { background: url('`, `') }</style>`, "http://example.com/a.png", `<style>p { background: url('https://example.com/a.png') }</style>`}, URLContext{Element: "style", CSS: true}},
+		{valueTest{"uppercase", `<A HREF="`, `">`, "/a", `<A HREF="#ZgotmplZ">`}, URLContext{Element: "a", Attr: "href"}},
+	}
+	for _, tt := range tests {
+		seen = nil
+		runValueTests(t, policy, []valueTest{tt.valueTest})
+		if len(seen) != 1 || seen[0] != tt.ctx {
+			t.Errorf("%s: URLPolicy called with %+v, want %+v", tt.name, seen, tt.ctx)
+		}
+	}
+
+	// Values in the query aren't checked.
+	seen = nil
+	runValueTests(t, policy, []valueTest{
+		{"query", `<a href="http://example.com/?q=`, `">`, "/a", `<a href="http://example.com/?q=%2Fa">`},
+	})
+	if len(seen) != 0 {
+		t.Errorf("query: URLPolicy called with %+v", seen)
+	}
+}
+
+func TestURLSchemes(t *testing.T) {
+	runValueTests(t, func(e *Escaper) { e.URLSchemes = []string{"tel", "Web+App"} }, []valueTest{
+		{"tel", `<a href="`, `">`, "tel:+1-555-0100", `<a href="tel:&#43;1-555-0100">`},
+		{"case insensitive", `<a href="`, `">`, "TEL:5550100", `<a href="TEL:5550100">`},
+		{"web+ scheme", `<a href="`, `">`, "web+app:x", `<a href="web&#43;app:x">`},
+		{"default schemes", `<a href="`, `">`, "https://example.com/", `<a href="https://example.com/">`},
+		{"other scheme", `<a href="`, `">`, "sms:5550100", `<a href="#ZgotmplZ">`},
+		{"javascript", `<a href="`, `">`, "javascript:alert(1)", `<a href="#ZgotmplZ">`},
+		{"CSS", `<p style="background: url(`, `)">`, "tel:1", `<p style="background: url(tel:1)">`},
+	})
+
+	// URLSchemes doesn't apply if there is a URLPolicy.
+	runValueTests(t, func(e *Escaper) {
+		e.URLSchemes = []string{"tel"}
+		e.URLPolicy = DefaultURLPolicy
+	}, []valueTest{
+		{"URLPolicy", `<a href="`, `">`, "tel:1", `<a href="#ZgotmplZ">`},
+	})
+}
+
+func TestDataURLTypes(t *testing.T) {
+	tests := []struct {
+		types []string
+		url   string
+		ok    bool
+	}{
+		{nil, "data:image/png;base64,AAAA", false},
+		{[]string{"image/png"}, "data:image/png;base64,AAAA", true},
+		{[]string{"image/png"}, "DATA:Image/PNG;base64,AAAA", true},
+		{[]string{"image/png"}, "data:image/svg+xml,<svg/>", false},
+		{[]string{"image/png"}, "data:text/html,<script>", false},
+		{[]string{"image/*"}, "data:image/gif;base64,AAAA", true},
+		{[]string{"image/*"}, "data:imagex/gif,AAAA", false},
+		{[]string{"image/*"}, "data:text/html,x", false},
+		{[]string{"image/*"}, "data:image/svg+xml,<svg/>", false},
+		{[]string{"image/*"}, "data:Image/SVG+XML;base64,AAAA", false},
+		{[]string{"image/svg+xml"}, "data:image/svg+xml,<svg/>", true},
+		{[]string{"text/plain"}, "data:,hello", true},
+		{[]string{"text/plain"}, "data:;base64,aGVsbG8=", true},
+		{[]string{"text/plain"}, "data: text/plain ,x", true},
+		{[]string{"*"}, "data:text/html,x", true},
+	}
+	for _, tt := range tests {
+		want := "#ZgotmplZ"
+		if tt.ok {
+			want = urlNormalizer(tt.url)
+		}
+		runValueTests(t, func(e *Escaper) { e.DataURLTypes = tt.types }, []valueTest{
+			{tt.url, `<img src="`, `">`, tt.url, `<img src="` + htmlEscaper(want) + `">`},
+		})
+	}
+
+	runValueTests(t, func(e *Escaper) { e.DataURLTypes = []string{"image/png"} }, []valueTest{
+		{"javascript", `<a href="`, `">`, "javascript:alert(1)", `<a href="#ZgotmplZ">`},
+		{"https", `<a href="`, `">`, "https://example.com/", `<a href="https://example.com/">`},
+		{"srcset", `<img srcset="`, `">`, "data:image/png;base64,AAAA 1x, data:text/html,x 2x", `<img srcset="data:image/png;base64,AAAA 1x, #ZgotmplZ,x 2x">`},
+	})
+	runValueTests(t, func(e *Escaper) { e.DataURLTypes = []string{"image/*"} }, []valueTest{
+		{"iframe svg", `<iframe src="`, `">`, "data:image/svg+xml,<svg onload=alert(1)>", `<iframe src="#ZgotmplZ">`},
+		{"object svg", `<object data="`, `">`, "data:image/svg+xml,<svg onload=alert(1)>", `<object data="#ZgotmplZ">`},
+		{"embed svg", `<embed src="`, `">`, "data:image/svg+xml,<svg onload=alert(1)>", `<embed src="#ZgotmplZ">`},
+	})
+}
@@ -0,0 +1,54 @@
+package escaper
+
+import "io"
+
+// A contextWriter is an io.Writer that escapes everything written to it with
+// an Escaper. It returns an error if the Escaper is not in one of the contexts
+// that ok accepts.
+type contextWriter struct {
+	e    *Escaper
+	name string
+	want string
+	ok   func(c context) bool
+}
+
+func (w contextWriter) Write(p []byte) (n int, err error) {
+	if err := w.e.stickyError(); err != nil {
+		return 0, err
+	}
+	if !w.ok(w.e.ctx) {
+		return 0, errorf(ErrHelperContext, "%s called in %v, not in %s", w.name, w.e.ctx.state, w.want)
+	}
+	if err := w.e.ValueBytes(p); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// TextWriter returns a Writer that escapes everything written to it as HTML
+// text, for libraries that write text to an io.Writer. Writes return an error
+// unless e is in HTML text (or in the text of a title or textarea element)
+// at the time.
+func (e *Escaper) TextWriter() io.Writer {
+	return contextWriter{e, "TextWriter.Write", "HTML text", func(c context) bool {
+		return c.state == stateText || c.state == stateRCDATA
+	}}
+}
+
+// AttrWriter returns a Writer that escapes everything written to it for a
+// quoted attribute value, such as a title. Writes return an error unless e is
+// in a quoted attribute value that is not a URL, script, or style sheet.
+func (e *Escaper) AttrWriter() io.Writer {
+	return contextWriter{e, "AttrWriter.Write", "a quoted attribute value", func(c context) bool {
+		return c.state == stateAttr && (c.delim == delimDoubleQuote || c.delim == delimSingleQuote)
+	}}
+}
+
+// JSStringWriter returns a Writer that escapes everything written to it for
+// a quoted JavaScript string. Writes return an error unless e is in a
+// JavaScript string.
+func (e *Escaper) JSStringWriter() io.Writer {
+	return contextWriter{e, "JSStringWriter.Write", "a JS string", func(c context) bool {
+		return c.state == stateJSDqStr || c.state == stateJSSqStr
+	}}
+}
@@ -0,0 +1,85 @@
+package escaper
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+func TestContextWriters(t *testing.T) {
+	const value = `a<b>"c' & é</script>`
+	tests := []struct {
+		name          string
+		before, after string
+		w             func(e *Escaper) io.Writer
+	}{
+		{"TextWriter", "<p>", "</p>", (*Escaper).TextWriter},
+		{"TextWriter RCDATA", "<title>", "</title>", (*Escaper).TextWriter},
+		{"AttrWriter", `<p title="`, `">`, (*Escaper).AttrWriter},
+		{"AttrWriter single quotes", `<p title='`, `'>`, (*Escaper).AttrWriter},
+		{"JSStringWriter", `<script>var x = "`, `";</script>`, (*Escaper).JSStringWriter},
+		{"JSStringWriter in attribute", `<a onclick="f('`, `')">`, (*Escaper).JSStringWriter},
+	}
+	for _, tt := range tests {
+		want, _ := render(nil, tt.before, value, tt.after)
+
+		var b strings.Builder
+		e := New(&b)
+		e.Literal(tt.before)
+		// Write a byte at a time, splitting the multi-byte character.
+		if _, err := io.Copy(tt.w(e), iotest.OneByteReader(strings.NewReader(value))); err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		e.Literal(tt.after)
+		if got := b.String(); got != want {
+			t.Errorf("%s: got %q, want %q", tt.name, got, want)
+		}
+	}
+}
+
+func TestContextWriterErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		before string
+		w      func(e *Escaper) io.Writer
+	}{
+		{"TextWriter in tag", "<p", (*Escaper).TextWriter},
+		{"TextWriter in script", "<script>", (*Escaper).TextWriter},
+		{"AttrWriter in text", "<p>", (*Escaper).AttrWriter},
+		{"AttrWriter unquoted", "<p title=", (*Escaper).AttrWriter},
+		{"AttrWriter in URL", `<a href="`, (*Escaper).AttrWriter},
+		{"AttrWriter in event handler", `<a onclick="`, (*Escaper).AttrWriter},
+		{"JSStringWriter in code", "<script>", (*Escaper).JSStringWriter},
+	}
+	for _, tt := range tests {
+		var b strings.Builder
+		e := New(&b)
+		e.Literal(tt.before)
+		n, err := tt.w(e).Write([]byte("x"))
+		if n != 0 || !errors.Is(err, ErrHelperContext) {
+			t.Errorf("%s: got %d, %v; want ErrHelperContext", tt.name, n, err)
+		}
+		if b.String() != tt.before {
+			t.Errorf("%s: wrote %q", tt.name, b.String()[len(tt.before):])
+		}
+	}
+}
+
+func TestContextWriterLibraries(t *testing.T) {
+	var b strings.Builder
+	e := New(&b)
+	e.Literal("<p>")
+	fmt.Fprintf(e.TextWriter(), "%d < %s", 1, "<b>")
+	e.Literal(`</p><script>var x = "`)
+	json.NewEncoder(e.JSStringWriter()).Encode(map[string]string{"a": "</script>"})
+	e.Literal(`";</script>`)
+	want := `<p>1 &lt; &lt;b&gt;</p><script>var x = "{\x22a\x22:\x22\\u003c\/script\\u003e\x22}\n";</script>`
+	if got := b.String(); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
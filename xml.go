@@ -0,0 +1,78 @@
+package escaper
+
+import (
+	"html"
+	"strconv"
+)
+
+// xmlEntityNames is the set of named character references that XML
+// predefines.
+var xmlEntityNames = map[string]bool{
+	"amp":  true,
+	"apos": true,
+	"gt":   true,
+	"lt":   true,
+	"quot": true,
+}
+
+// decodesEntities reports whether character references are decoded in text
+// that is parsed in context c: in HTML text, RCDATA, and attribute values.
+func decodesEntities(c context) bool {
+	return c.state == stateText || c.state == stateRCDATA || c.delim != delimNone
+}
+
+// xmlEntities rewrites the character references in the piece s[i:i+n], which
+// was parsed in context c0, for Escaper.XML. Named references that XML
+// doesn't predefine are replaced with numeric ones, an '&' that doesn't start
+// a reference is written as "&amp;", and "&#34;" and "&#39;" are written as
+// "&quot;" and "&apos;". out holds the output for s[:written]; it returns the
+// updated out and written.
+//
+// A reference that is split between two calls to Literal, such as "&nb"
+// followed by "sp;", can't be recognized, so it is left as it is.
+func (e *Escaper) xmlEntities(c0 context, out []byte, s string, written, i, n int) ([]byte, int) {
+	if !decodesEntities(c0) {
+		return out, written
+	}
+	end := i + n
+	for k := i; k < end; k++ {
+		if s[k] != '&' {
+			continue
+		}
+		j := k + 1
+		for j < end && (asciiAlphaNum(s[j]) || s[j] == '#') {
+			j++
+		}
+		var repl string
+		switch name := s[k+1 : j]; {
+		case j == len(s):
+			// The rest of the reference may be in the next literal.
+			continue
+		case j == end || s[j] != ';' || name == "":
+			repl = "&amp;"
+			j = k
+		case name == "#34":
+			repl = "&quot;"
+		case name == "#39":
+			repl = "&apos;"
+		case name[0] == '#' || xmlEntityNames[name]:
+			continue
+		default:
+			ref := s[k : j+1]
+			decoded := html.UnescapeString(ref)
+			if decoded == ref {
+				repl = "&amp;"
+				j = k
+				break
+			}
+			for _, r := range decoded {
+				repl += "&#" + strconv.Itoa(int(r)) + ";"
+			}
+		}
+		out = append(out, s[written:k]...)
+		out = append(out, repl...)
+		written = j + 1
+		k = j
+	}
+	return out, written
+}
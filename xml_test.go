@@ -0,0 +1,118 @@
+package escaper
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestXMLEntities(t *testing.T) {
+	tests := []struct {
+		name     string
+		literals []string
+		want     string
+	}{
+		{"named", []string{"<p>a&nbsp;b &copy;</p>"}, "<p>a&#160;b &#169;</p>"},
+		{"predefined", []string{"<p>&amp;&lt;&gt;&quot;&apos;</p>"}, "<p>&amp;&lt;&gt;&quot;&apos;</p>"},
+		{"numeric", []string{"<p>&#169;&#x41;&#39;</p>"}, "<p>&#169;&#x41;&apos;</p>"},
+		{"bare ampersand", []string{"<p>a & b &bogus;</p>"}, "<p>a &amp; b &amp;bogus;</p>"},
+		{"attribute", []string{`<a title="a&nbsp;b" onclick="a && b">`}, `<a title="a&#160;b" onclick="a &amp;&amp; b">`},
+		{"script", []string{"<script>a && b</script>"}, "<script>a && b</script>"},
+		{"split reference", []string{"<p>&nb", "sp;</p>"}, "<p>&nbsp;</p>"},
+		{"ampersand at end", []string{"<p>a &", " b</p>"}, "<p>a & b</p>"},
+	}
+	for _, tt := range tests {
+		var b strings.Builder
+		e := New(&b)
+		e.XML = true
+		for _, l := range tt.literals {
+			if err := e.Literal(l); err != nil {
+				t.Fatalf("%s: %v", tt.name, err)
+			}
+		}
+		if got := b.String(); got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestXMLMode(t *testing.T) {
+	var b strings.Builder
+	e := New(&b)
+	e.XML = true
+	e.PreferUnquoted = true
+	e.Literal("<p>")
+	e.Value(`it's "q"`)
+	e.Literal("<br><input")
+	e.Attr("size", 3)
+	e.BoolAttr("disabled", true)
+	e.Literal("></p>")
+	if err := e.Finish(); err != nil {
+		t.Fatal(err)
+	}
+	want := `<p>it&apos;s &quot;q&quot;<br/><input size="3" disabled="disabled"/></p>`
+	if got := b.String(); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestXMLValues(t *testing.T) {
+	runValueTests(t, func(e *Escaper) { e.XML = true }, []valueTest{
+		{"text", "<p>", "</p>", `it's "q" & <b> &nbsp;`, "<p>it&apos;s &quot;q&quot; &amp; &lt;b&gt; &amp;nbsp;</p>"},
+		{"single-quoted attribute", "<a title='", "'>", `it's "q"`, "<a title='it&apos;s &quot;q&quot;'>"},
+		{"double-quoted attribute", `<a title="`, `">`, "&copy;", `<a title="&amp;copy;">`},
+		{"URL", `<a href="/x?a=1&amp;b=`, `">`, "x&y z", `<a href="/x?a=1&amp;b=x%26y%20z">`},
+		{"RCDATA", "<title>", "</title>", "it's &", "<title>it&apos;s &amp;</title>"},
+		{"script", "<script>var x = ", ";</script>", "it's <&>", `<script>var x = "it's \u003c\u0026\u003e";</script>`},
+		{"CDATA", "<svg><text><![CDATA[", "]]></text></svg>", "'&", "<svg><text><![CDATA['&]]></text></svg>"},
+	})
+}
+
+func TestXMLHelpers(t *testing.T) {
+	tests := []struct {
+		name  string
+		write func(e *Escaper) error
+		want  string
+	}{
+		{
+			"InputValue checked",
+			func(e *Escaper) error {
+				e.Literal(`<input type="checkbox"`)
+				if err := e.InputValue("checkbox", true); err != nil {
+					return err
+				}
+				return e.Literal(">")
+			},
+			`<input type="checkbox" checked="checked"/>`,
+		},
+		{
+			"InputValue unchecked",
+			func(e *Escaper) error {
+				e.Literal(`<input type="radio"`)
+				if err := e.InputValue("radio", false); err != nil {
+					return err
+				}
+				return e.Literal(">")
+			},
+			`<input type="radio"/>`,
+		},
+		{
+			"Media",
+			func(e *Escaper) error {
+				return e.Media("video", []MediaSource{{URL: "/a.mp4", Type: "video/mp4"}}, MediaAttrs{Controls: true, Muted: true})
+			},
+			`<video controls="controls" muted="muted"><source src="/a.mp4" type="video/mp4"/></video>`,
+		},
+	}
+	for _, tt := range tests {
+		var b strings.Builder
+		e := New(&b)
+		e.XML = true
+		if err := tt.write(e); err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if got := b.String(); got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}